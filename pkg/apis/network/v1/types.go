@@ -0,0 +1,59 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Protocol DHCP protocol of a lease
+type Protocol string
+
+const (
+	ProtocolDHCPv4 Protocol = "DHCPv4"
+	ProtocolDHCPv6 Protocol = "DHCPv6"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DHCPLease address leased to a virtual machine interface, maintained by the pod controller,
+// one resource per hardware address and protocol in the namespace of the virt-launcher pod
+type DHCPLease struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DHCPLeaseSpec   `json:"spec"`
+	Status DHCPLeaseStatus `json:"status,omitempty"`
+}
+
+type DHCPLeaseSpec struct {
+	Protocol   Protocol `json:"protocol"`
+	MACAddress string   `json:"macAddress"`
+	IPAddress  string   `json:"ipAddress"`
+	Prefix     string   `json:"prefix,omitempty"` // prefix delegated by DHCPv6 IA_PD
+	Subnet     string   `json:"subnet"`
+	VM         string   `json:"vm,omitempty"`
+	Pod        string   `json:"pod"`
+	LeaseTime  int      `json:"leaseTime"` // seconds
+}
+
+type DHCPLeaseStatus struct {
+	// State Allocated, Offered, Bound, Renewed, Expired, Released or Declined
+	State            string       `json:"state,omitempty"`
+	FirstOfferTime   *metav1.Time `json:"firstOfferTime,omitempty"`
+	BoundTime        *metav1.Time `json:"boundTime,omitempty"`
+	LastRenewTime    *metav1.Time `json:"lastRenewTime,omitempty"`
+	ExpiryTime       *metav1.Time `json:"expiryTime,omitempty"`
+	LastDiscoverTime *metav1.Time `json:"lastDiscoverTime,omitempty"` // DHCPDISCOVER or DHCPv6 Solicit
+	LastRequestTime  *metav1.Time `json:"lastRequestTime,omitempty"`  // DHCPREQUEST or DHCPv6 Request, Renew and Rebind
+	Hostname         string       `json:"hostname,omitempty"`         // host name sent by the guest
+	VendorClass      string       `json:"vendorClass,omitempty"`      // vendor class sent by the guest
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type DHCPLeaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []DHCPLease `json:"items"`
+}
@@ -6,12 +6,14 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	kubeovnv1 "github.com/kubeovn/kube-ovn/pkg/apis/kubeovn/v1"
 	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -22,10 +24,13 @@ import (
 	cache2 "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
+	dcloudv1 "tydic.io/dcloud-dhcp-controller/pkg/apis/network/v1"
+	"tydic.io/dcloud-dhcp-controller/pkg/audit"
 	"tydic.io/dcloud-dhcp-controller/pkg/cache"
 	"tydic.io/dcloud-dhcp-controller/pkg/controller/pod"
 	"tydic.io/dcloud-dhcp-controller/pkg/controller/service"
 	"tydic.io/dcloud-dhcp-controller/pkg/controller/subnet"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
 	dhcpv4 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v4"
 	dhcpv6 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v6"
 	"tydic.io/dcloud-dhcp-controller/pkg/metrics"
@@ -46,9 +51,23 @@ var (
 	ComponentName = "dcloud-dhcp-controller"
 )
 
+// Lease stores selected by the LEASE_STORE environment variable
+const (
+	LeaseStoreConfigMap   = "configmap"
+	LeaseStoreBolt        = "bolt"
+	DefaultLeaseStorePath = "/var/lib/dcloud-dhcp-controller/leases.db"
+)
+
+// DefaultDHCPBindTimeout time after which a virtual machine that sent no DHCP request is reported, DHCP_BIND_TIMEOUT=0 disables it
+const DefaultDHCPBindTimeout = 5 * time.Minute
+
+// DefaultAuditLogMaxSize size in megabytes at which the audit log file is rotated
+const DefaultAuditLogMaxSize = 100
+
 func init() {
 	utilruntime.Must(k8sscheme.AddToScheme(scheme))
 	utilruntime.Must(kubeovnv1.AddToScheme(scheme))
+	utilruntime.Must(dcloudv1.AddToScheme(scheme))
 }
 
 type handler struct {
@@ -65,6 +84,10 @@ type handler struct {
 	recorder       record.EventRecorder
 	lock           *resourcelock.LeaseLock
 	leaderId       string
+	leaseStore     string   // configmap, bolt or empty to keep the leases in memory only
+	leaseDB        *bolt.DB // bbolt file of the bolt lease store
+	bindTimeout    time.Duration
+	auditLogger    *audit.Logger // nil when AUDIT_LOG is not set
 }
 
 func Register() *handler {
@@ -95,6 +118,41 @@ func (h *handler) Init() {
 	h.podName = os.Getenv("POD_NAME")
 	h.podNamespace = os.Getenv("POD_NAMESPACE")
 
+	h.bindTimeout = DefaultDHCPBindTimeout
+	if timeout := os.Getenv("DHCP_BIND_TIMEOUT"); timeout != "" {
+		bindTimeout, err := time.ParseDuration(timeout)
+		handleErr(err)
+		h.bindTimeout = bindTimeout
+	}
+
+	h.leaseStore = os.Getenv("LEASE_STORE")
+	if h.leaseStore == LeaseStoreBolt {
+		path := os.Getenv("LEASE_STORE_PATH")
+		if path == "" {
+			path = DefaultLeaseStorePath
+		}
+		// opened once, the file is locked as long as the process runs
+		db, err := dhcp.OpenBoltDB(path)
+		handleErr(err)
+		h.leaseDB = db
+	} else if h.leaseStore != "" && h.leaseStore != LeaseStoreConfigMap {
+		handleErr(fmt.Errorf("unknown lease store <%s>, must be %s or %s", h.leaseStore, LeaseStoreConfigMap, LeaseStoreBolt))
+	}
+
+	if sink := os.Getenv("AUDIT_LOG"); sink != "" {
+		// stdout or the path of a file rotated by size
+		auditConfig := audit.Config{
+			Sink:       sink,
+			MaxSize:    envInt("AUDIT_LOG_MAX_SIZE", DefaultAuditLogMaxSize),
+			MaxBackups: envInt("AUDIT_LOG_MAX_BACKUPS", 0),
+			MaxAge:     envInt("AUDIT_LOG_MAX_AGE", 0),
+			Compress:   os.Getenv("AUDIT_LOG_COMPRESS") == "true",
+		}
+		logger, err := audit.New(auditConfig)
+		handleErr(err)
+		h.auditLogger = logger
+	}
+
 	config, err := h.getKubeConfig()
 	handleErr(err)
 	h.kubeClient, err = kubernetes.NewForConfig(config)
@@ -160,6 +218,29 @@ func (h *handler) Run(mainCtx context.Context) {
 			},
 		},
 	})
+
+	// flush the audit log file and release the lease store file lock on shutdown
+	if err := h.auditLogger.Close(); err != nil {
+		log.Errorf("(app.Run) cannot close the audit log: %s", err.Error())
+	}
+	if h.leaseDB != nil {
+		if err := h.leaseDB.Close(); err != nil {
+			log.Errorf("(app.Run) cannot close the lease store: %s", err.Error())
+		}
+	}
+}
+
+// envInt Returns the integer value of the environment variable or the default value when it is not set
+func envInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		handleErr(fmt.Errorf("invalid %s <%s>: %v", key, value, err))
+	}
+	return i
 }
 
 // resyncPeriod computes the time interval a shared informer waits before resyncing with the api server
@@ -170,15 +251,19 @@ func resyncPeriod(minResyncPeriod time.Duration) time.Duration {
 
 func (h *handler) RunServices(ctx context.Context) {
 
-	// initialize the dhcp v4 service
-	h.dhcpV4 = dhcpv4.New(ctx)
-	// initialize the dhcp v6 service
-	h.dhcpV6 = dhcpv6.New(ctx)
-
 	// initialize the metrics service
 	h.metrics = metrics.New()
 	go h.metrics.Run(ctx)
 
+	// initialize the dhcp v4 service
+	h.dhcpV4 = dhcpv4.New(ctx, h.metrics, h.recorder)
+	// initialize the dhcp v6 service
+	h.dhcpV6 = dhcpv6.New(ctx)
+	// restore the persisted leases before any DHCP server is started
+	h.setLeaseStores()
+	h.dhcpV4.SetAuditLogger(h.auditLogger)
+	h.dhcpV6.SetAuditLogger(h.auditLogger)
+
 	// add the network.dcloud.tydic.io/leader pod label
 	h.addLeaderPodLabel()
 
@@ -210,13 +295,18 @@ func (h *handler) RunServices(ctx context.Context) {
 	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, transform, resyncConfig)
 
 	networkCache := cache.NewNetworkCache(h.networkInfos)
-	subnetController := subnet.NewController(h.scheme, factory, config, networkCache, h.dhcpV4, h.dhcpV6, h.metrics, h.recorder)
-	podController := pod.NewController(factory, h.dhcpV4, h.dhcpV6, h.metrics, h.recorder, subnetController)
+	duidStore := dhcpv6.NewDUIDStore(kubeClient, h.podNamespace)
+	subnetController := subnet.NewController(h.scheme, factory, config, networkCache, h.dhcpV4, h.dhcpV6, duidStore, h.metrics, h.recorder)
+	podController := pod.NewController(h.scheme, factory, config, kubeClient, h.dhcpV4, h.dhcpV6, h.metrics, h.recorder, subnetController)
+	podController.SetBindTimeout(h.bindTimeout)
 	subnetController.SetPodNotify(podController)
+	h.dhcpV4.SetLeaseNotify(podController)
+	h.dhcpV6.SetLeaseNotify(podController)
 	serviceController := service.NewController(h.podNamespace, factory, networkCache, h.recorder, podCache, subnetController)
 
 	factory.Start(ctx.Done())
 	factory.WaitForCacheSync(ctx.Done())
+	podController.PruneLeases()
 
 	// Ensure a coroutine sequence for handling subnet events
 	go subnetController.Run(ctx, true, 1)
@@ -226,6 +316,30 @@ func (h *handler) RunServices(ctx context.Context) {
 
 }
 
+func (h *handler) setLeaseStores() {
+	var storeV4, storeV6 dhcp.LeaseStore
+	switch h.leaseStore {
+	case LeaseStoreConfigMap:
+		storeV4 = dhcp.NewConfigMapLeaseStore(h.kubeClient, h.podNamespace, "v4", dhcp.DefaultLeaseStoreShards)
+		storeV6 = dhcp.NewConfigMapLeaseStore(h.kubeClient, h.podNamespace, "v6", dhcp.DefaultLeaseStoreShards)
+	case LeaseStoreBolt:
+		var err error
+		storeV4, err = dhcp.NewBoltLeaseStore(h.leaseDB, "v4")
+		handleErr(err)
+		storeV6, err = dhcp.NewBoltLeaseStore(h.leaseDB, "v6")
+		handleErr(err)
+	default:
+		return
+	}
+	// a store that can not be read is not fatal, the leases are rebuilt from the pods
+	if err := h.dhcpV4.SetLeaseStore(storeV4); err != nil {
+		log.Errorf("(app.setLeaseStores) cannot restore DHCPv4 leases: %s", err.Error())
+	}
+	if err := h.dhcpV6.SetLeaseStore(storeV6); err != nil {
+		log.Errorf("(app.setLeaseStores) cannot restore DHCPv6 leases: %s", err.Error())
+	}
+}
+
 // The addLeaderPodLabel and removeLeaderPodLabel funtions are managing the dcloud.tydic.io/leader label.
 // This label is used by the metrics-service to determine the active leader.
 // If the function(s) fail the application should ignore it and still service DHCP requests.
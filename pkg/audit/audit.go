@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	ProtocolDHCPv4 = "DHCPv4"
+	ProtocolDHCPv6 = "DHCPv6"
+)
+
+// SinkStdout writes the audit log to the standard output instead of a file
+const SinkStdout = "stdout"
+
+// Config audit log sink, the file is rotated when it reaches MaxSize
+type Config struct {
+	Sink       string // stdout or the path of the audit log file
+	MaxSize    int    // megabytes, default 100
+	MaxBackups int    // rotated files to keep, 0 keeps all
+	MaxAge     int    // days to keep the rotated files, 0 keeps them
+	Compress   bool   // gzip the rotated files
+}
+
+// Logger writes one JSON line per DHCP transaction, independently of the log level.
+// A nil Logger discards the transactions.
+type Logger struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+	closed bool // the transactions ended after Close are discarded
+}
+
+// Transaction audit record of a DHCP request and its reply
+type Transaction struct {
+	Time        time.Time `json:"time"`
+	Protocol    string    `json:"protocol"`
+	Interface   string    `json:"interface,omitempty"`
+	MAC         string    `json:"mac,omitempty"`
+	XID         string    `json:"xid,omitempty"`
+	MessageType string    `json:"messageType,omitempty"`
+	ReplyType   string    `json:"replyType,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	Subnet      string    `json:"subnet,omitempty"`
+	VM          string    `json:"vm,omitempty"`
+	LatencyMs   float64   `json:"latencyMs"`
+	DropReason  string    `json:"dropReason,omitempty"` // the request was not answered
+
+	logger *Logger
+}
+
+// New Open the audit log sink
+func New(config Config) (*Logger, error) {
+	switch config.Sink {
+	case "":
+		return nil, fmt.Errorf("audit log sink is empty")
+	case SinkStdout:
+		return &Logger{writer: os.Stdout}, nil
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = 100
+	}
+	file := &lumberjack.Logger{
+		Filename:   config.Sink,
+		MaxSize:    config.MaxSize,
+		MaxBackups: config.MaxBackups,
+		MaxAge:     config.MaxAge,
+		Compress:   config.Compress,
+	}
+	return &Logger{writer: file, closer: file}, nil
+}
+
+// Begin Start the record of a transaction received on the interface
+func (l *Logger) Begin(protocol, iface string) *Transaction {
+	return &Transaction{
+		Time:      time.Now(),
+		Protocol:  protocol,
+		Interface: iface,
+		logger:    l,
+	}
+}
+
+// Drop Record why the request was not answered
+func (t *Transaction) Drop(reason string) {
+	t.DropReason = reason
+}
+
+// End Write the transaction, must be called once when the request has been handled
+func (t *Transaction) End() {
+	if t.logger == nil {
+		return
+	}
+	t.LatencyMs = float64(time.Since(t.Time).Microseconds()) / 1000
+	t.logger.write(t)
+}
+
+func (l *Logger) write(t *Transaction) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return
+	}
+	if _, err := l.writer.Write(append(b, '\n')); err != nil {
+		log.Errorf("(audit.write) cannot write the audit log: %v", err)
+	}
+}
+
+// Close Close the audit log file
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	return l.closer.Close()
+}
@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := New(Config{Sink: path})
+	assert.NoError(t, err)
+
+	tx := logger.Begin(ProtocolDHCPv4, "net1")
+	tx.MAC, tx.MessageType, tx.ReplyType = "52:54:00:a1:b2:c3", "DISCOVER", "OFFER"
+	tx.End()
+	tx = logger.Begin(ProtocolDHCPv6, "net1")
+	tx.Drop("no lease found")
+	tx.End()
+	assert.NoError(t, logger.Close())
+	// the transactions ended during the shutdown are discarded
+	tx = logger.Begin(ProtocolDHCPv4, "net1")
+	tx.End()
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Len(t, lines, 2)
+
+	var first, second Transaction
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, ProtocolDHCPv4, first.Protocol)
+	assert.Equal(t, "OFFER", first.ReplyType)
+	assert.Empty(t, first.DropReason)
+	assert.Equal(t, ProtocolDHCPv6, second.Protocol)
+	assert.Equal(t, "no lease found", second.DropReason)
+
+	// a nil logger discards the transactions
+	var disabled *Logger
+	tx = disabled.Begin(ProtocolDHCPv4, "net1")
+	tx.End()
+	assert.NoError(t, disabled.Close())
+
+	_, err = New(Config{})
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package pod
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -10,9 +11,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -29,12 +34,23 @@ type Controller struct {
 	dhcpV6    *dhcpv6.DHCPAllocator
 	metrics   *metrics.MetricsAllocator
 	recorder  record.EventRecorder
+	// leaseClient maintains the DHCPLease resources, nil if the client could not be created
+	leaseClient rest.Interface
+	kubeClient  *kubernetes.Clientset
+	// bindTimeout time after which a guest that sent no request is reported
+	bindTimeout  time.Duration
+	leaderSince  time.Time   // creation of the controller, when this replica became leader
+	bindWarnings sets.String // PodKey/Protocol/Mac of the reported leases
+	bindMutex    sync.Mutex
 	controller.Worker[Event]
 	subnetClient
 }
 
 func NewController(
+	scheme *runtime.Scheme,
 	factory informers.SharedInformerFactory,
+	config *rest.Config,
+	kubeClient *kubernetes.Clientset,
 	dhcpV4 *dhcpv4.DHCPAllocator,
 	dhcpV6 *dhcpv6.DHCPAllocator,
 	metrics *metrics.MetricsAllocator,
@@ -58,6 +74,10 @@ func NewController(
 		dhcpV6:       dhcpV6,
 		metrics:      metrics,
 		recorder:     recorder,
+		leaseClient:  newDHCPLeaseClient(scheme, config),
+		kubeClient:   kubeClient,
+		leaderSince:  time.Now(),
+		bindWarnings: sets.NewString(),
 		subnetClient: subnetClient,
 	}
 	c.Worker = controller.Worker[Event]{
@@ -72,6 +92,22 @@ func (c *Controller) EnQueue(event Event) {
 	c.queue.Add(event)
 }
 
+// PruneLeases Delete the restored leases of the pods deleted while no leader was running,
+// must be called after the pod cache is synced
+func (c *Controller) PruneLeases() {
+	podKeys := sets.NewString(c.dhcpV4.ListPodKeys()...).Insert(c.dhcpV6.ListPodKeys()...)
+	for _, podKey := range podKeys.List() {
+		namespace, name, err := cache.SplitMetaNamespaceKey(podKey)
+		if err != nil {
+			continue
+		}
+		if _, err := c.podLister.Pods(namespace).Get(name); errors.IsNotFound(err) {
+			log.Infof("(pod.PruneLeases) Pod <%s> of a restored lease does not exist anymore", podKey)
+			c.EnQueue(Event{ObjKey: types.NamespacedName{Namespace: namespace, Name: name}, Operation: DELETE})
+		}
+	}
+}
+
 func (c *Controller) sync(ctx context.Context, event Event) error {
 	switch event.Operation {
 	case ADD, UPDATE:
@@ -94,6 +130,27 @@ func (c *Controller) sync(ctx context.Context, event Event) error {
 			log.Errorf("(pod.sync) Handler delete Pod <%s> failed: %v", event.KeyString(), err)
 			return err
 		}
+	case FORCERENEW, RECONFIGURE:
+		pod, err := c.podLister.Pods(event.ObjKey.Namespace).Get(event.ObjKey.Name)
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			log.Errorf("(pod.sync) fetching object with key <%s> from store failed with %v", event.KeyString(), err)
+			return err
+		}
+		log.Infof("(pod.sync) Handler %s Pod <%s> of subnet <%s>", event.Operation, event.KeyString(), event.Subnet)
+		c.HandlerReconfigurePod(event.ObjKey, pod, event.Subnet, event.Operation)
+	case LEASE:
+		pod, err := c.podLister.Pods(event.ObjKey.Namespace).Get(event.ObjKey.Name)
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			log.Errorf("(pod.sync) fetching object with key <%s> from store failed with %v", event.KeyString(), err)
+			return err
+		}
+		c.syncDHCPLeases(event.ObjKey, pod)
+		c.syncDHCPStatus(event.ObjKey, pod)
+		c.checkDHCPBind(event.ObjKey, pod)
 	}
 	return nil
 }
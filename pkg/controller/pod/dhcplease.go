@@ -0,0 +1,300 @@
+package pod
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	dcloudv1 "tydic.io/dcloud-dhcp-controller/pkg/apis/network/v1"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	"tydic.io/dcloud-dhcp-controller/pkg/util"
+)
+
+const dhcpLeaseResource = "dhcpleases"
+
+// leaseSyncDelay delay of the DHCPLease sync after a DHCP transaction, the transactions of a pod are batched
+const leaseSyncDelay = 2 * time.Second
+
+// The DHCPLease client has its own rate limit, the lease writes do not take the budget of the pod and subnet syncs
+const (
+	leaseClientQPS   = 5
+	leaseClientBurst = 10
+)
+
+func newDHCPLeaseClient(scheme *runtime.Scheme, config *rest.Config) rest.Interface {
+	configShallowCopy := *config
+	configShallowCopy.GroupVersion = &dcloudv1.SchemeGroupVersion
+	if configShallowCopy.UserAgent == "" {
+		configShallowCopy.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	configShallowCopy.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{
+		CodecFactory: serializer.NewCodecFactory(scheme),
+	}
+	configShallowCopy.APIPath = "/apis"
+	configShallowCopy.ContentType = runtime.ContentTypeJSON
+	configShallowCopy.QPS = leaseClientQPS
+	configShallowCopy.Burst = leaseClientBurst
+	configShallowCopy.RateLimiter = nil
+	restClient, err := rest.RESTClientFor(&configShallowCopy)
+	if err != nil {
+		log.Errorf("(pod.newDHCPLeaseClient) cannot create the DHCPLease client: %v", err)
+		return nil
+	}
+	return restClient
+}
+
+// dhcpLeaseName one DHCPLease per hardware address and protocol, example: 525400a1b2c3-v4
+func dhcpLeaseName(protocol dcloudv1.Protocol, mac string) string {
+	suffix := "v4"
+	if protocol == dcloudv1.ProtocolDHCPv6 {
+		suffix = "v6"
+	}
+	return fmt.Sprintf("%s-%s", strings.ReplaceAll(strings.ToLower(mac), ":", ""), suffix)
+}
+
+func metaTime(t time.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	// the API server keeps whole seconds, compare the times at the same precision
+	mt := metav1.NewTime(t).Rfc3339Copy()
+	return &mt
+}
+
+func timeOf(t *metav1.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time
+}
+
+// dhcpLeaseStateEqual The DHCPLease is only written on a new state or a new binding,
+// the timestamps of the offers and renewals alone are not worth an update
+func dhcpLeaseStateEqual(a, b dcloudv1.DHCPLeaseStatus) bool {
+	return a.State == b.State && a.BoundTime.Equal(b.BoundTime)
+}
+
+// desiredDHCPLease Build the DHCPLease of the hardware address from the allocator lease
+func (c *Controller) desiredDHCPLease(pod *corev1.Pod, protocol dcloudv1.Protocol, mac string) (*dcloudv1.DHCPLease, bool) {
+	var spec dcloudv1.DHCPLeaseSpec
+	var status dhcp.LeaseStatus
+	var vmKey string
+	switch protocol {
+	case dcloudv1.ProtocolDHCPv4:
+		lease, ok := c.dhcpV4.GetDHCPLease(mac)
+		if !ok {
+			return nil, false
+		}
+		spec = dcloudv1.DHCPLeaseSpec{IPAddress: lease.ClientIP.String(), Subnet: lease.SubnetKey}
+		if subnet, ok := c.dhcpV4.GetSubnet(lease.SubnetKey); ok {
+			spec.LeaseTime = subnet.LeaseTime
+		}
+		status, vmKey = lease.Status, lease.VMKey
+	case dcloudv1.ProtocolDHCPv6:
+		lease, ok := c.dhcpV6.GetDHCPLease(mac)
+		if !ok {
+			return nil, false
+		}
+		spec = dcloudv1.DHCPLeaseSpec{IPAddress: lease.ClientIP.String(), Subnet: lease.SubnetKey}
+		if lease.Prefix != nil {
+			spec.Prefix = lease.Prefix.String()
+		}
+		if subnet, ok := c.dhcpV6.GetSubnet(lease.SubnetKey); ok {
+			spec.LeaseTime = subnet.LeaseTime
+		}
+		status, vmKey = lease.Status, lease.VMKey
+	default:
+		return nil, false
+	}
+	spec.Protocol = protocol
+	spec.MACAddress = mac
+	spec.Pod = pod.Name
+	if _, vmName, found := strings.Cut(vmKey, "/"); found {
+		spec.VM = vmName
+	}
+
+	return &dcloudv1.DHCPLease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            dhcpLeaseName(protocol, mac),
+			Namespace:       pod.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(pod, corev1.SchemeGroupVersion.WithKind("Pod"))},
+		},
+		Spec: spec,
+		Status: dcloudv1.DHCPLeaseStatus{
+			State:            string(status.StateAt(time.Now())),
+			FirstOfferTime:   metaTime(status.FirstOfferTime),
+			BoundTime:        metaTime(status.BoundTime),
+			LastRenewTime:    metaTime(status.LastRenewTime),
+			ExpiryTime:       metaTime(status.ExpiryTime),
+			LastDiscoverTime: metaTime(status.LastDiscoverTime),
+			LastRequestTime:  metaTime(status.LastRequestTime),
+			Hostname:         status.Hostname,
+			VendorClass:      status.VendorClass,
+		},
+	}, true
+}
+
+// syncDHCPLease Create or update the DHCPLease of the hardware address held by the pod
+func (c *Controller) syncDHCPLease(pod *corev1.Pod, protocol dcloudv1.Protocol, mac string) {
+	desired, ok := c.desiredDHCPLease(pod, protocol, mac)
+	if !ok {
+		return
+	}
+	if c.leaseClient != nil {
+		desired = c.updateDHCPLease(pod, protocol, desired)
+	}
+
+	var expiry time.Time
+	if desired.Status.ExpiryTime != nil {
+		expiry = desired.Status.ExpiryTime.Time
+	}
+	c.metrics.UpdateVMDHCPLeaseState(fmt.Sprintf("%s/%s", desired.Namespace, desired.Spec.VM), desired.Spec.Subnet,
+		string(protocol), desired.Spec.IPAddress, mac, desired.Status.State, expiry)
+	// refresh the state once the binding expires, a renewal moves the expiry time forward
+	if state := dhcp.LeaseState(desired.Status.State); state == dhcp.LeaseStateBound || state == dhcp.LeaseStateRenewed {
+		c.queue.AddAfter(Event{ObjKey: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, Operation: LEASE},
+			time.Until(expiry)+time.Second)
+	}
+}
+
+// updateDHCPLease Create or update the DHCPLease, returns the lease as written,
+// with the status restored from the current DHCPLease if the allocator lost it
+func (c *Controller) updateDHCPLease(pod *corev1.Pod, protocol dcloudv1.Protocol, desired *dcloudv1.DHCPLease) *dcloudv1.DHCPLease {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := &dcloudv1.DHCPLease{}
+		err := c.leaseClient.Get().Namespace(desired.Namespace).Resource(dhcpLeaseResource).Name(desired.Name).Do(ctx).Into(current)
+		if errors.IsNotFound(err) {
+			return c.createDHCPLease(ctx, desired)
+		} else if err != nil {
+			return err
+		}
+		if c.restoreLeaseStatus(protocol, current) {
+			if restored, ok := c.desiredDHCPLease(pod, protocol, desired.Spec.MACAddress); ok {
+				desired = restored
+			}
+		}
+		if reflect.DeepEqual(current.Spec, desired.Spec) && dhcpLeaseStateEqual(current.Status, desired.Status) &&
+			reflect.DeepEqual(current.OwnerReferences, desired.OwnerReferences) {
+			return nil
+		}
+		current.OwnerReferences = desired.OwnerReferences
+		current.Spec = desired.Spec
+		current.Status = desired.Status
+		err = c.leaseClient.Put().Namespace(desired.Namespace).Resource(dhcpLeaseResource).Name(desired.Name).Body(current).Do(ctx).Error()
+		if errors.IsNotFound(err) {
+			// collected with its previous owner before the handover, example: the source pod of a live migration
+			return c.createDHCPLease(ctx, desired)
+		}
+		return err
+	})
+	if err != nil {
+		// the status is refreshed by the next transaction, do not requeue the pod
+		log.Warnf("(pod.updateDHCPLease) Pod <%s/%s> cannot sync DHCPLease <%s>: %v", pod.Namespace, pod.Name, desired.Name, err)
+	}
+	return desired
+}
+
+// restoreLeaseStatus Restore the status of the allocator lease from the current DHCPLease if the guest has not sent
+// any request since the lease was added, example: a new leader without lease store, returns true if restored
+func (c *Controller) restoreLeaseStatus(protocol dcloudv1.Protocol, current *dcloudv1.DHCPLease) bool {
+	status := dhcp.LeaseStatus{
+		State:            dhcp.LeaseState(current.Status.State),
+		FirstOfferTime:   timeOf(current.Status.FirstOfferTime),
+		BoundTime:        timeOf(current.Status.BoundTime),
+		LastRenewTime:    timeOf(current.Status.LastRenewTime),
+		ExpiryTime:       timeOf(current.Status.ExpiryTime),
+		LastDiscoverTime: timeOf(current.Status.LastDiscoverTime),
+		LastRequestTime:  timeOf(current.Status.LastRequestTime),
+		Hostname:         current.Status.Hostname,
+		VendorClass:      current.Status.VendorClass,
+	}
+	if status.Initial() {
+		return false
+	}
+	if status.State == dhcp.LeaseStateExpired {
+		// expiry is derived from the expiry time of the binding
+		status.State = dhcp.LeaseStateBound
+	}
+	clientIP := net.ParseIP(current.Spec.IPAddress)
+	switch protocol {
+	case dcloudv1.ProtocolDHCPv4:
+		return c.dhcpV4.RestoreLeaseStatus(current.Spec.MACAddress, clientIP, status)
+	case dcloudv1.ProtocolDHCPv6:
+		return c.dhcpV6.RestoreLeaseStatus(current.Spec.MACAddress, clientIP, status)
+	}
+	return false
+}
+
+// createDHCPLease Create the DHCPLease, a lease created meanwhile is reported as a conflict to be updated instead
+func (c *Controller) createDHCPLease(ctx context.Context, desired *dcloudv1.DHCPLease) error {
+	err := c.leaseClient.Post().Namespace(desired.Namespace).Resource(dhcpLeaseResource).Body(desired).Do(ctx).Error()
+	if errors.IsAlreadyExists(err) {
+		return errors.NewConflict(dcloudv1.Resource(dhcpLeaseResource), desired.Name, err)
+	}
+	return err
+}
+
+// syncDHCPLeases Refresh the DHCPLeases of all hardware addresses of the pod
+func (c *Controller) syncDHCPLeases(podKey types.NamespacedName, pod *corev1.Pod) {
+	macs, _ := c.dhcpV4.GetPodMacAddress(podKey.String())
+	for _, mac := range macs {
+		c.syncDHCPLease(pod, dcloudv1.ProtocolDHCPv4, mac)
+	}
+	macs, _ = c.dhcpV6.GetPodMacAddress(podKey.String())
+	for _, mac := range macs {
+		c.syncDHCPLease(pod, dcloudv1.ProtocolDHCPv6, mac)
+	}
+}
+
+// releaseDHCPLease Delete the DHCPLease of a hardware address no longer leased,
+// or hand it over to the pod still holding the lease, example: the target pod of a live migration
+func (c *Controller) releaseDHCPLease(podKey types.NamespacedName, protocol dcloudv1.Protocol, mac string) {
+	podKeys, ok := c.dhcpV4.GetMacPodKeys(mac)
+	if protocol == dcloudv1.ProtocolDHCPv6 {
+		podKeys, ok = c.dhcpV6.GetMacPodKeys(mac)
+	}
+	if ok && len(podKeys) > 0 {
+		if podNamespace, podName, found := strings.Cut(podKeys[0], "/"); found {
+			if pod, err := c.podLister.Pods(podNamespace).Get(podName); err == nil {
+				c.syncDHCPLease(pod, protocol, mac)
+				return
+			}
+		}
+	}
+
+	c.metrics.DeleteVMDHCPLeaseState(util.GetVMKeyByPodKey(podKey), string(protocol), mac)
+	if c.leaseClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	namespace, name := podKey.Namespace, dhcpLeaseName(protocol, mac)
+	err := c.leaseClient.Delete().Namespace(namespace).Resource(dhcpLeaseResource).Name(name).Do(ctx).Error()
+	if err != nil && !errors.IsNotFound(err) {
+		log.Warnf("(pod.releaseDHCPLease) cannot delete DHCPLease <%s/%s>: %v", namespace, name, err)
+	}
+}
+
+// NotifyLease Refresh the DHCPLeases of the pod after the state of a lease changed, the changes received
+// within leaseSyncDelay are synced at once, example: DISCOVER, REQUEST and the guests retransmissions
+func (c *Controller) NotifyLease(podKey string) {
+	namespace, name, found := strings.Cut(podKey, "/")
+	if !found {
+		return
+	}
+	c.queue.AddAfter(Event{ObjKey: types.NamespacedName{Namespace: namespace, Name: name}, Operation: LEASE}, leaseSyncDelay)
+}
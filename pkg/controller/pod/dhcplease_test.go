@@ -0,0 +1,258 @@
+package pod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	k8sscheme "k8s.io/client-go/kubernetes/scheme"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	fakerest "k8s.io/client-go/rest/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	dcloudv1 "tydic.io/dcloud-dhcp-controller/pkg/apis/network/v1"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	dhcpv4 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v4"
+	dhcpv6 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v6"
+	"tydic.io/dcloud-dhcp-controller/pkg/metrics"
+)
+
+const testMAC = "52:54:00:a1:b2:c3"
+
+// leaseServer in-memory DHCPLease API behind the fake REST client
+type leaseServer struct {
+	leases map[string]*dcloudv1.DHCPLease // namespace/name -> lease
+	// collectOnPut the garbage collector deletes the lease right before the next update
+	collectOnPut bool
+	requests     []string
+}
+
+func (s *leaseServer) roundTrip(req *http.Request) (*http.Response, error) {
+	// /apis/<group>/<version>/namespaces/<namespace>/dhcpleases[/<name>]
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/apis/"+dcloudv1.SchemeGroupVersion.String()+"/"), "/")
+	key := parts[1] + "/"
+	if len(parts) > 3 {
+		key += parts[3]
+	}
+	s.requests = append(s.requests, req.Method)
+	notFound := apierrors.NewNotFound(dcloudv1.Resource(dhcpLeaseResource), key)
+
+	switch req.Method {
+	case http.MethodGet:
+		if lease, ok := s.leases[key]; ok {
+			return s.response(http.StatusOK, lease)
+		}
+		return s.response(http.StatusNotFound, &notFound.ErrStatus)
+	case http.MethodPost, http.MethodPut:
+		lease := &dcloudv1.DHCPLease{}
+		body, _ := io.ReadAll(req.Body)
+		if err := json.Unmarshal(body, lease); err != nil {
+			return nil, err
+		}
+		if req.Method == http.MethodPost {
+			key += lease.Name
+			if _, ok := s.leases[key]; ok {
+				exists := apierrors.NewAlreadyExists(dcloudv1.Resource(dhcpLeaseResource), key)
+				return s.response(http.StatusConflict, &exists.ErrStatus)
+			}
+		} else {
+			if s.collectOnPut {
+				s.collectOnPut = false
+				delete(s.leases, key)
+			}
+			if _, ok := s.leases[key]; !ok {
+				return s.response(http.StatusNotFound, &notFound.ErrStatus)
+			}
+		}
+		s.leases[key] = lease
+		return s.response(http.StatusOK, lease)
+	case http.MethodDelete:
+		if _, ok := s.leases[key]; !ok {
+			return s.response(http.StatusNotFound, &notFound.ErrStatus)
+		}
+		delete(s.leases, key)
+		return s.response(http.StatusOK, &metav1.Status{Status: metav1.StatusSuccess})
+	}
+	return s.response(http.StatusMethodNotAllowed, &metav1.Status{Status: metav1.StatusFailure})
+}
+
+func (s *leaseServer) response(code int, obj runtime.Object) (*http.Response, error) {
+	if status, ok := obj.(*metav1.Status); ok {
+		status.APIVersion, status.Kind, status.Code = "v1", "Status", int32(code)
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", runtime.ContentTypeJSON)
+	return &http.Response{StatusCode: code, Header: header, Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+// newTestController Returns a pod controller syncing the DHCPLeases with the lease server
+func newTestController(t *testing.T, server *leaseServer, pods ...*corev1.Pod) *Controller {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, k8sscheme.AddToScheme(scheme))
+	assert.NoError(t, dcloudv1.AddToScheme(scheme))
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range pods {
+		assert.NoError(t, indexer.Add(pod))
+	}
+	recorder := record.NewFakeRecorder(10)
+	m := metrics.NewMetricsAllocator()
+	return &Controller{
+		podLister: listerv1.NewPodLister(indexer),
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		dhcpV4:    dhcpv4.NewDHCPAllocator(context.TODO(), m, recorder),
+		dhcpV6:    dhcpv6.NewDHCPAllocator(context.TODO()),
+		metrics:   m,
+		recorder:  recorder,
+		leaseClient: &fakerest.RESTClient{
+			NegotiatedSerializer: serializer.WithoutConversionCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)},
+			GroupVersion:         dcloudv1.SchemeGroupVersion,
+			VersionedAPIPath:     "/apis/" + dcloudv1.SchemeGroupVersion.String(),
+			Client:               fakerest.CreateHTTPClient(server.roundTrip),
+		},
+		bindWarnings: sets.NewString(),
+	}
+}
+
+func newTestPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name + "-uid")},
+	}
+}
+
+func Test_SyncDHCPLease(t *testing.T) {
+	pod1, pod2 := newTestPod("pod1"), newTestPod("pod2")
+	server := &leaseServer{leases: map[string]*dcloudv1.DHCPLease{}}
+	c := newTestController(t, server, pod1, pod2)
+	lease := dhcpv4.DHCPLease{ClientIP: net.ParseIP("10.0.0.12").To4(), SubnetKey: "subnet1", VMKey: "default/vm1"}
+	assert.NoError(t, c.dhcpV4.AddPodDHCPLease(testMAC, "default/pod1", lease))
+	key := "default/" + dhcpLeaseName(dcloudv1.ProtocolDHCPv4, testMAC)
+	owner := func() string {
+		if stored, ok := server.leases[key]; ok && len(stored.OwnerReferences) == 1 {
+			return stored.OwnerReferences[0].Name
+		}
+		return ""
+	}
+
+	// create
+	c.syncDHCPLeases(types.NamespacedName{Namespace: "default", Name: "pod1"}, pod1)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost}, server.requests)
+	assert.Equal(t, "10.0.0.12", server.leases[key].Spec.IPAddress)
+	assert.Equal(t, "vm1", server.leases[key].Spec.VM)
+	assert.Equal(t, string(dcloudv1.ProtocolDHCPv4), string(server.leases[key].Spec.Protocol))
+	assert.Equal(t, "pod1", owner())
+
+	// unchanged
+	server.requests = nil
+	c.syncDHCPLeases(types.NamespacedName{Namespace: "default", Name: "pod1"}, pod1)
+	assert.Equal(t, []string{http.MethodGet}, server.requests)
+
+	// the timestamps of a renewal alone are not written
+	server.requests = nil
+	lastRequestTime := metav1.NewTime(time.Now().Add(-time.Hour)).Rfc3339Copy()
+	server.leases[key].Status.LastRequestTime = &lastRequestTime
+	c.syncDHCPLeases(types.NamespacedName{Namespace: "default", Name: "pod1"}, pod1)
+	assert.Equal(t, []string{http.MethodGet}, server.requests)
+
+	// update
+	server.requests = nil
+	server.leases[key].Spec.IPAddress = "10.0.0.99"
+	c.syncDHCPLeases(types.NamespacedName{Namespace: "default", Name: "pod1"}, pod1)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPut}, server.requests)
+	assert.Equal(t, "10.0.0.12", server.leases[key].Spec.IPAddress)
+
+	// handover to the target pod of a live migration, the garbage collector deleted the lease with the source pod
+	assert.NoError(t, c.dhcpV4.AddPodDHCPLease(testMAC, "default/pod2", lease))
+	assert.NoError(t, c.dhcpV4.DeletePodDHCPLease("default/pod1"))
+	server.requests = nil
+	server.collectOnPut = true
+	c.releaseDHCPLease(types.NamespacedName{Namespace: "default", Name: "pod1"}, dcloudv1.ProtocolDHCPv4, testMAC)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPut, http.MethodPost}, server.requests)
+	assert.Equal(t, "pod2", owner())
+
+	// delete
+	assert.NoError(t, c.dhcpV4.DeletePodDHCPLease("default/pod2"))
+	server.requests = nil
+	c.releaseDHCPLease(types.NamespacedName{Namespace: "default", Name: "pod2"}, dcloudv1.ProtocolDHCPv4, testMAC)
+	assert.Equal(t, []string{http.MethodDelete}, server.requests)
+	assert.Empty(t, server.leases)
+	// a lease already deleted is not an error
+	c.releaseDHCPLease(types.NamespacedName{Namespace: "default", Name: "pod2"}, dcloudv1.ProtocolDHCPv4, testMAC)
+}
+
+func Test_NotifyLease(t *testing.T) {
+	c := newTestController(t, &leaseServer{})
+	for i := 0; i < 3; i++ {
+		c.NotifyLease("default/pod1")
+	}
+
+	// the transactions are batched into a single sync
+	assert.Equal(t, 0, c.queue.Len())
+	assert.Eventually(t, func() bool { return c.queue.Len() == 1 }, 2*leaseSyncDelay, 100*time.Millisecond)
+	event, _ := c.queue.Get()
+	assert.Equal(t, Event{ObjKey: types.NamespacedName{Namespace: "default", Name: "pod1"}, Operation: LEASE}, event)
+}
+
+func Test_RestoreLeaseStatus(t *testing.T) {
+	pod1 := newTestPod("pod1")
+	server := &leaseServer{leases: map[string]*dcloudv1.DHCPLease{}}
+	c := newTestController(t, server, pod1)
+	lease := dhcpv4.DHCPLease{ClientIP: net.ParseIP("10.0.0.12").To4(), SubnetKey: "subnet1", VMKey: "default/vm1"}
+	assert.NoError(t, c.dhcpV4.AddPodDHCPLease(testMAC, "default/pod1", lease))
+
+	// DHCPLease written by the previous leader
+	boundTime := metav1.NewTime(time.Now().Add(-time.Minute)).Rfc3339Copy()
+	expiryTime := metav1.NewTime(boundTime.Add(time.Hour))
+	previous, _ := c.desiredDHCPLease(pod1, dcloudv1.ProtocolDHCPv4, testMAC)
+	previous.Status = dcloudv1.DHCPLeaseStatus{
+		State:           string(dhcp.LeaseStateBound),
+		FirstOfferTime:  &boundTime,
+		BoundTime:       &boundTime,
+		ExpiryTime:      &expiryTime,
+		LastRequestTime: &boundTime,
+	}
+	key := "default/" + previous.Name
+	server.leases[key] = previous.DeepCopy()
+
+	// the allocator of the new leader has no status, the DHCPLease keeps its state
+	c.syncDHCPLeases(types.NamespacedName{Namespace: "default", Name: "pod1"}, pod1)
+	assert.Equal(t, []string{http.MethodGet}, server.requests)
+	assert.Equal(t, string(dhcp.LeaseStateBound), server.leases[key].Status.State)
+	restored, _ := c.dhcpV4.GetDHCPLease(testMAC)
+	assert.Equal(t, dhcp.LeaseStateBound, restored.Status.State)
+	assert.True(t, restored.Status.BoundTime.Equal(boundTime.Time))
+	families, err := c.metrics.Gather()
+	assert.NoError(t, err)
+	var states []string
+	for _, family := range families {
+		if family.GetName() != "dcloud_vm_dhcp_lease_state" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "state" {
+					states = append(states, label.GetValue())
+				}
+			}
+		}
+	}
+	assert.Equal(t, []string{string(dhcp.LeaseStateBound)}, states)
+}
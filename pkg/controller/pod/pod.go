@@ -2,6 +2,7 @@ package pod
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"slices"
@@ -15,6 +16,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
+	dcloudv1 "tydic.io/dcloud-dhcp-controller/pkg/apis/network/v1"
 	"tydic.io/dcloud-dhcp-controller/pkg/dhcp/v4"
 	v6 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v6"
 	"tydic.io/dcloud-dhcp-controller/pkg/util"
@@ -150,6 +152,9 @@ func (c *Controller) HandlerAddOrUpdatePod(ctx context.Context, podKey types.Nam
 		log.Warnf("(pod.HandlerAddOrUpdatePod) Pod <%s> handler dhcp lease error: %s", podKey.String(), strings.Join(errs, "; "))
 	}
 
+	c.syncDHCPStatus(podKey, pod)
+	c.checkDHCPBind(podKey, pod)
+
 	return nil
 }
 
@@ -159,22 +164,45 @@ func (c *Controller) handlerDHCPV6Lease(subnetName string, network networkv1.Net
 	if ipv6Address = util.GetFirstIPV6Addr(network); ipv6Address == nil {
 		return fmt.Errorf("network <%s>: no IPv6 address available", network.Name)
 	}
+	// find delegated prefix, the pod annotation takes precedence over the subnet pool
+	multusNamespace, multusName, _ := strings.Cut(network.Name, "/")
+	prefix, err := util.GetDelegatedPrefix(pod, multusName, multusNamespace)
+	if err != nil {
+		c.recorder.Event(pod, corev1.EventTypeWarning, "DHCPLeaseError", err.Error())
+	}
+	subnet, hasSubnet := c.dhcpV6.GetSubnet(subnetName)
+	if prefix, err = c.dhcpV6.DelegatePrefix(network.Mac, subnet, ipv6Address, prefix); err != nil {
+		c.recorder.Event(pod, corev1.EventTypeWarning, "DHCPLeaseError", err.Error())
+	}
 	// add dhcpv6 lease
-	dhcpLease := v6.DHCPLease{ClientIP: ipv6Address, SubnetKey: subnetName}
+	vmKey := util.GetVMKeyByPodKey(podKey)
+	dhcpLease := v6.DHCPLease{ClientIP: ipv6Address, SubnetKey: subnetName, VMKey: vmKey, Prefix: prefix}
 	existLease := c.dhcpV6.HasPodDHCPLease(network.Mac, podKey.String(), dhcpLease)
-	if err := c.dhcpV6.AddPodDHCPLease(network.Mac, podKey.String(), dhcpLease); err == nil {
-		// update vm dhcpv6 lease gauge
-		vmKey := util.GetVMKeyByPodKey(podKey)
-		if subnet, ok := c.dhcpV6.GetSubnet(subnetName); ok {
-			c.metrics.UpdateVMDHCPv6Lease(vmKey, subnetName, ipv6Address.String(), network.Mac, subnet.LeaseTime)
-		} else {
-			c.metrics.DeleteVMDHCPv6Lease(vmKey, network.Mac)
-		}
-		if !existLease {
-			c.recorder.Event(pod, corev1.EventTypeNormal, "DHCPLease",
-				fmt.Sprintf("Additional network <%s> DHCPv6 lease successfully added", network.Name))
+	err = c.dhcpV6.AddPodDHCPLease(network.Mac, podKey.String(), dhcpLease)
+	if errors.Is(err, v6.ErrPrefixOverlap) {
+		// a prefix conflict must not cost the guest its address, lease it without a prefix
+		c.recorder.Event(pod, corev1.EventTypeWarning, "DHCPLeaseError", err.Error())
+		prefix, dhcpLease.Prefix = nil, nil
+		existLease = c.dhcpV6.HasPodDHCPLease(network.Mac, podKey.String(), dhcpLease)
+		err = c.dhcpV6.AddPodDHCPLease(network.Mac, podKey.String(), dhcpLease)
+	}
+	if err != nil {
+		return fmt.Errorf("network <%s>: %v", network.Name, err)
+	}
+	// update vm dhcpv6 lease gauge
+	if hasSubnet {
+		c.metrics.UpdateVMDHCPv6Lease(vmKey, subnetName, ipv6Address.String(), network.Mac, subnet.LeaseTime)
+		if prefix != nil {
+			c.metrics.UpdateVMDHCPv6DelegatedPrefix(vmKey, subnetName, prefix.String(), network.Mac, subnet.LeaseTime)
 		}
+	} else {
+		c.metrics.DeleteVMDHCPv6Lease(vmKey, network.Mac)
 	}
+	if !existLease {
+		c.recorder.Event(pod, corev1.EventTypeNormal, "DHCPLease",
+			fmt.Sprintf("Additional network <%s> DHCPv6 lease successfully added", network.Name))
+	}
+	c.syncDHCPLease(pod, dcloudv1.ProtocolDHCPv6, network.Mac)
 
 	return nil
 }
@@ -186,11 +214,11 @@ func (c *Controller) handlerDHCPV4Lease(subnetName string, network networkv1.Net
 		return fmt.Errorf("network <%s>: no IPv4 address available", network.Name)
 	}
 	// add dhcpv4 lease
-	dhcpLease := v4.DHCPLease{ClientIP: ipv4Address, SubnetKey: subnetName}
+	vmKey := util.GetVMKeyByPodKey(podKey)
+	dhcpLease := v4.DHCPLease{ClientIP: ipv4Address, SubnetKey: subnetName, VMKey: vmKey}
 	existLease := c.dhcpV4.HasPodDHCPLease(network.Mac, podKey.String(), dhcpLease)
 	if err := c.dhcpV4.AddPodDHCPLease(network.Mac, podKey.String(), dhcpLease); err == nil {
 		// update vm dhcpv4 lease gauge
-		vmKey := util.GetVMKeyByPodKey(podKey)
 		if subnet, ok := c.dhcpV4.GetSubnet(subnetName); ok {
 			c.metrics.UpdateVMDHCPv4Lease(vmKey, subnetName, ipv4Address.String(), network.Mac, subnet.LeaseTime)
 		} else {
@@ -200,12 +228,63 @@ func (c *Controller) handlerDHCPV4Lease(subnetName string, network networkv1.Net
 			c.recorder.Event(pod, corev1.EventTypeNormal, "DHCPLease",
 				fmt.Sprintf("Additional network <%s> DHCPv4 lease successfully added", network.Name))
 		}
+		c.syncDHCPLease(pod, dcloudv1.ProtocolDHCPv4, network.Mac)
 	}
 
 	return nil
 }
 
+// HandlerReconfigurePod Send a DHCPv4 FORCERENEW or a DHCPv6 Reconfigure to every lease of the pod in the subnet.
+// Guests that did not negotiate a nonce or key are skipped, they get the options on their next renewal.
+func (c *Controller) HandlerReconfigurePod(podKey types.NamespacedName, pod *corev1.Pod, subnetName string, operation Operation) {
+	var macs []string
+	var reconfigure func(hwAddr string) error
+	var notNegotiated error
+	protocol := "DHCPv4 FORCERENEW"
+	switch operation {
+	case FORCERENEW:
+		macs, _ = c.dhcpV4.GetPodMacAddress(podKey.String())
+		reconfigure, notNegotiated = c.dhcpV4.ForceRenew, v4.ErrForceRenewNotNegotiated
+	case RECONFIGURE:
+		macs, _ = c.dhcpV6.GetPodMacAddress(podKey.String())
+		reconfigure, notNegotiated = c.dhcpV6.Reconfigure, v6.ErrReconfigureNotAccepted
+		protocol = "DHCPv6 Reconfigure"
+	default:
+		return
+	}
+
+	for _, mac := range macs {
+		if !c.leaseInSubnet(operation, mac, subnetName) {
+			continue
+		}
+		err := reconfigure(mac)
+		switch {
+		case errors.Is(err, notNegotiated):
+			log.Debugf("(pod.HandlerReconfigurePod) Pod <%s> hardware address <%s>: %v", podKey.String(), mac, err)
+		case err != nil:
+			log.Warnf("(pod.HandlerReconfigurePod) Pod <%s> hardware address <%s>: %v", podKey.String(), mac, err)
+			c.recorder.Event(pod, corev1.EventTypeWarning, "DHCPReconfigureError",
+				fmt.Sprintf("Failed to send %s to hardware address <%s>: %v", protocol, mac, err))
+		default:
+			c.recorder.Event(pod, corev1.EventTypeNormal, "DHCPReconfigure",
+				fmt.Sprintf("%s sent to hardware address <%s> after the options of subnet <%s> changed", protocol, mac, subnetName))
+		}
+	}
+}
+
+func (c *Controller) leaseInSubnet(operation Operation, mac, subnetName string) bool {
+	if operation == FORCERENEW {
+		lease, ok := c.dhcpV4.GetDHCPLease(mac)
+		return ok && lease.SubnetKey == subnetName
+	}
+	lease, ok := c.dhcpV6.GetDHCPLease(mac)
+	return ok && lease.SubnetKey == subnetName
+}
+
 func (c *Controller) HandlerDeletePod(ctx context.Context, podKey types.NamespacedName) error {
+	macsV4, _ := c.dhcpV4.GetPodMacAddress(podKey.String())
+	macsV6, _ := c.dhcpV6.GetPodMacAddress(podKey.String())
+
 	// delete pod ipv4 lease
 	_ = c.dhcpV4.DeletePodDHCPLease(podKey.String())
 	// delete vm dhcpv4 lease gauge
@@ -216,6 +295,16 @@ func (c *Controller) HandlerDeletePod(ctx context.Context, podKey types.Namespac
 	// delete vm dhcpv6 lease gauge
 	c.deleteVMDHCPv6Lease(podKey)
 
+	c.forgetDHCPBind(podKey)
+
+	// delete the DHCPLease resources
+	for _, mac := range macsV4 {
+		c.releaseDHCPLease(podKey, dcloudv1.ProtocolDHCPv4, mac)
+	}
+	for _, mac := range macsV6 {
+		c.releaseDHCPLease(podKey, dcloudv1.ProtocolDHCPv6, mac)
+	}
+
 	return nil
 }
 
@@ -225,6 +314,7 @@ func (c *Controller) deleteVMDHCPv4Lease(podKey types.NamespacedName) {
 		c.metrics.DeletePartialVMDHCPv4Lease(util.GetVMKeyByPodKey(podKey), macs)
 	} else {
 		c.metrics.DeleteVMDHCPv4Lease(util.GetVMKeyByPodKey(podKey), "")
+		c.metrics.DeleteVMDHCPv4Decline(util.GetVMKeyByPodKey(podKey))
 	}
 }
 
@@ -0,0 +1,190 @@
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	dcloudv1 "tydic.io/dcloud-dhcp-controller/pkg/apis/network/v1"
+	"tydic.io/dcloud-dhcp-controller/pkg/util"
+)
+
+// DHCPInterfaceStatus DHCP binding of a virtual machine interface, reported by the dhcp-status pod annotation
+type DHCPInterfaceStatus struct {
+	Interface string            `json:"interface,omitempty"`
+	Network   string            `json:"network"`
+	MAC       string            `json:"mac"`
+	Protocol  dcloudv1.Protocol `json:"protocol"`
+	IP        string            `json:"ip"`
+	State     string            `json:"state"`
+	BoundTime *metav1.Time      `json:"boundTime"`
+}
+
+// SetBindTimeout Warn when the guest sent no request the given time after the pod became Running, 0 disables the warning
+func (c *Controller) SetBindTimeout(timeout time.Duration) {
+	c.bindTimeout = timeout
+}
+
+// syncDHCPStatus Patch the dhcp-status annotation with the bound leases of the pod interfaces
+func (c *Controller) syncDHCPStatus(podKey types.NamespacedName, pod *corev1.Pod) {
+	if c.kubeClient == nil {
+		return
+	}
+	networkStatus, ok := GetNetworkStatus(pod)
+	if !ok {
+		return
+	}
+	var networks []networkv1.NetworkStatus
+	if err := json.Unmarshal([]byte(networkStatus), &networks); err != nil {
+		return
+	}
+
+	current, hasCurrent := pod.Annotations[util.AnnoDCloudDHCPStatus]
+	var previous []DHCPInterfaceStatus
+	if hasCurrent {
+		_ = json.Unmarshal([]byte(current), &previous)
+	}
+	statuses := c.dhcpStatuses(pod, networks, previous)
+	if len(statuses) == 0 && !hasCurrent {
+		return
+	}
+	value, err := json.Marshal(statuses)
+	if err != nil || string(value) == current {
+		return
+	}
+	if err := util.PatchPodAnnotations(c.kubeClient, pod.DeepCopy(), map[string]string{util.AnnoDCloudDHCPStatus: string(value)}); err != nil {
+		log.Warnf("(pod.syncDHCPStatus) Pod <%s> cannot patch the DHCP status annotation: %v", podKey.String(), err)
+	}
+}
+
+// dhcpStatuses Returns the bound leases of the pod interfaces, a lease whose status the allocator does not know,
+// example: a new leader without lease store, keeps its previous entry until the guest sends a request
+func (c *Controller) dhcpStatuses(pod *corev1.Pod, networks []networkv1.NetworkStatus, previous []DHCPInterfaceStatus) []DHCPInterfaceStatus {
+	statuses := []DHCPInterfaceStatus{}
+	for _, network := range networks {
+		for _, protocol := range []dcloudv1.Protocol{dcloudv1.ProtocolDHCPv4, dcloudv1.ProtocolDHCPv6} {
+			lease, ok := c.desiredDHCPLease(pod, protocol, network.Mac)
+			if !ok {
+				continue
+			}
+			if lease.Status.LastDiscoverTime == nil && lease.Status.LastRequestTime == nil {
+				for _, status := range previous {
+					if status.MAC == network.Mac && status.Protocol == protocol && status.IP == lease.Spec.IPAddress {
+						statuses = append(statuses, status)
+						break
+					}
+				}
+				continue
+			}
+			if lease.Status.BoundTime == nil {
+				continue
+			}
+			statuses = append(statuses, DHCPInterfaceStatus{
+				Interface: network.Interface,
+				Network:   network.Name,
+				MAC:       network.Mac,
+				Protocol:  protocol,
+				IP:        lease.Spec.IPAddress,
+				State:     lease.Status.State,
+				BoundTime: lease.Status.BoundTime,
+			})
+		}
+	}
+	return statuses
+}
+
+// podRunningSince Returns the time the containers of the pod became ready
+func podRunningSince(pod *corev1.Pod) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.ContainersReady && condition.Status == corev1.ConditionTrue {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return time.Now()
+}
+
+// bindCheckDelay Returns the time left before the bind check of the pod, false if the pod is not checked.
+// The timeout starts when the pod became Running, or when this controller became leader if later,
+// as the requests received by the previous leader are not known.
+func (c *Controller) bindCheckDelay(pod *corev1.Pod) (time.Duration, bool) {
+	switch pod.Status.Phase {
+	case corev1.PodPending:
+		return c.bindTimeout, true
+	case corev1.PodRunning:
+	default:
+		return 0, false
+	}
+	since := podRunningSince(pod)
+	if c.leaderSince.After(since) {
+		since = c.leaderSince
+	}
+	return time.Until(since.Add(c.bindTimeout)), true
+}
+
+// checkDHCPBind Raise a warning event once per lease whose guest sent no request bindTimeout after the pod became Running
+func (c *Controller) checkDHCPBind(podKey types.NamespacedName, pod *corev1.Pod) {
+	if c.bindTimeout <= 0 {
+		return
+	}
+	wait, ok := c.bindCheckDelay(pod)
+	if !ok {
+		return
+	}
+	if wait > 0 {
+		c.queue.AddAfter(Event{ObjKey: podKey, Operation: LEASE}, wait)
+		return
+	}
+
+	var pending []string
+	macs, _ := c.dhcpV4.GetPodMacAddress(podKey.String())
+	for _, mac := range macs {
+		if lease, ok := c.dhcpV4.GetDHCPLease(mac); ok && lease.Status.LastRequestTime.IsZero() {
+			pending = append(pending, fmt.Sprintf("%s/%s", dcloudv1.ProtocolDHCPv4, mac))
+		}
+	}
+	macs, _ = c.dhcpV6.GetPodMacAddress(podKey.String())
+	for _, mac := range macs {
+		lease, ok := c.dhcpV6.GetDHCPLease(mac)
+		if !ok || !lease.Status.LastRequestTime.IsZero() {
+			continue
+		}
+		// stateless subnets only answer Information-Request messages
+		if subnet, ok := c.dhcpV6.GetSubnet(lease.SubnetKey); ok && !subnet.Stateless {
+			pending = append(pending, fmt.Sprintf("%s/%s", dcloudv1.ProtocolDHCPv6, mac))
+		}
+	}
+
+	c.bindMutex.Lock()
+	defer c.bindMutex.Unlock()
+	for _, lease := range pending {
+		key := podKey.String() + "/" + lease
+		if c.bindWarnings.Has(key) {
+			continue
+		}
+		c.bindWarnings.Insert(key)
+		protocol, mac, _ := strings.Cut(lease, "/")
+		c.recorder.Event(pod, corev1.EventTypeWarning, "DHCPNotBound",
+			fmt.Sprintf("No %s request received from hardware address <%s> %s after the pod became Running",
+				protocol, mac, c.bindTimeout.String()))
+	}
+}
+
+// forgetDHCPBind Remove the bind warnings of a deleted pod
+func (c *Controller) forgetDHCPBind(podKey types.NamespacedName) {
+	c.bindMutex.Lock()
+	defer c.bindMutex.Unlock()
+	for _, key := range c.bindWarnings.List() {
+		if strings.HasPrefix(key, podKey.String()+"/") {
+			c.bindWarnings.Delete(key)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package pod
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	dcloudv1 "tydic.io/dcloud-dhcp-controller/pkg/apis/network/v1"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	dhcpv4 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v4"
+)
+
+// newRunningPod Returns a pod whose containers became ready at the given time
+func newRunningPod(name string, since time.Time) *corev1.Pod {
+	pod := newTestPod(name)
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:               corev1.ContainersReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(since),
+	}}
+	return pod
+}
+
+func Test_DHCPStatuses(t *testing.T) {
+	boundTime := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	networks := []networkv1.NetworkStatus{{Name: "default/provider", Interface: "net1", Mac: testMAC}}
+	previous := DHCPInterfaceStatus{
+		Interface: "net1",
+		Network:   "default/provider",
+		MAC:       testMAC,
+		Protocol:  dcloudv1.ProtocolDHCPv4,
+		IP:        "10.0.0.12",
+		State:     string(dhcp.LeaseStateRenewed),
+		BoundTime: &metav1.Time{Time: boundTime.Add(-time.Hour)},
+	}
+	tests := []struct {
+		status   *dhcp.LeaseStatus
+		clientIP string
+		previous []DHCPInterfaceStatus
+		want     []DHCPInterfaceStatus
+	}{
+		{
+			// the guest has not sent any request yet
+			clientIP: "10.0.0.12",
+			want:     []DHCPInterfaceStatus{},
+		},
+		{
+			// the status was lost with the previous leader
+			clientIP: "10.0.0.12",
+			previous: []DHCPInterfaceStatus{previous},
+			want:     []DHCPInterfaceStatus{previous},
+		},
+		{
+			// the address of the lease changed meanwhile
+			clientIP: "10.0.0.13",
+			previous: []DHCPInterfaceStatus{previous},
+			want:     []DHCPInterfaceStatus{},
+		},
+		{
+			status:   &dhcp.LeaseStatus{State: dhcp.LeaseStateOffered, LastDiscoverTime: boundTime},
+			clientIP: "10.0.0.12",
+			previous: []DHCPInterfaceStatus{previous},
+			want:     []DHCPInterfaceStatus{},
+		},
+		{
+			status: &dhcp.LeaseStatus{
+				State:           dhcp.LeaseStateBound,
+				BoundTime:       boundTime,
+				ExpiryTime:      boundTime.Add(time.Hour),
+				LastRequestTime: boundTime,
+			},
+			clientIP: "10.0.0.12",
+			previous: []DHCPInterfaceStatus{previous},
+			want: []DHCPInterfaceStatus{{
+				Interface: "net1",
+				Network:   "default/provider",
+				MAC:       testMAC,
+				Protocol:  dcloudv1.ProtocolDHCPv4,
+				IP:        "10.0.0.12",
+				State:     string(dhcp.LeaseStateBound),
+				BoundTime: &metav1.Time{Time: boundTime},
+			}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			pod := newTestPod("pod1")
+			c := newTestController(t, &leaseServer{}, pod)
+			clientIP := net.ParseIP(test.clientIP).To4()
+			lease := dhcpv4.DHCPLease{ClientIP: clientIP, SubnetKey: "subnet1", VMKey: "default/vm1"}
+			assert.NoError(t, c.dhcpV4.AddPodDHCPLease(testMAC, "default/pod1", lease))
+			if test.status != nil {
+				assert.True(t, c.dhcpV4.RestoreLeaseStatus(testMAC, clientIP, *test.status))
+			}
+
+			statuses := c.dhcpStatuses(pod, networks, test.previous)
+			assert.Len(t, statuses, len(test.want))
+			for j := range test.want {
+				assert.Equal(t, test.want[j].IP, statuses[j].IP)
+				assert.Equal(t, test.want[j].State, statuses[j].State)
+				assert.True(t, test.want[j].BoundTime.Equal(statuses[j].BoundTime))
+			}
+		})
+	}
+}
+
+func Test_BindCheckDelay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		pod         *corev1.Pod
+		leaderSince time.Time
+		wantCheck   bool
+		wantWait    bool
+	}{
+		{
+			pod:         &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			leaderSince: now.Add(-time.Hour),
+			wantCheck:   true,
+			wantWait:    true,
+		},
+		{
+			pod:         newRunningPod("pod1", now.Add(-time.Minute)),
+			leaderSince: now.Add(-time.Hour),
+			wantCheck:   true,
+			wantWait:    true,
+		},
+		{
+			pod:         newRunningPod("pod1", now.Add(-time.Hour)),
+			leaderSince: now.Add(-time.Hour),
+			wantCheck:   true,
+		},
+		{
+			// the requests received by the previous leader are not known
+			pod:         newRunningPod("pod1", now.Add(-time.Hour)),
+			leaderSince: now.Add(-time.Minute),
+			wantCheck:   true,
+			wantWait:    true,
+		},
+		{
+			pod:         &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+			leaderSince: now.Add(-time.Hour),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			c := &Controller{bindTimeout: 5 * time.Minute, leaderSince: test.leaderSince}
+			wait, check := c.bindCheckDelay(test.pod)
+			assert.Equal(t, test.wantCheck, check)
+			assert.Equal(t, test.wantWait, wait > 0)
+		})
+	}
+}
+
+func Test_CheckDHCPBind(t *testing.T) {
+	tests := []struct {
+		requested  bool
+		wantEvents int
+	}{
+		{
+			wantEvents: 1,
+		},
+		{
+			requested: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			pod := newRunningPod("pod1", time.Now().Add(-time.Hour))
+			c := newTestController(t, &leaseServer{}, pod)
+			c.bindTimeout, c.leaderSince = 5*time.Minute, time.Now().Add(-time.Hour)
+			clientIP := net.ParseIP("10.0.0.12").To4()
+			lease := dhcpv4.DHCPLease{ClientIP: clientIP, SubnetKey: "subnet1", VMKey: "default/vm1"}
+			assert.NoError(t, c.dhcpV4.AddPodDHCPLease(testMAC, "default/pod1", lease))
+			if test.requested {
+				status := dhcp.LeaseStatus{State: dhcp.LeaseStateOffered, LastRequestTime: time.Now()}
+				assert.True(t, c.dhcpV4.RestoreLeaseStatus(testMAC, clientIP, status))
+			}
+
+			// the warning is raised once per lease
+			podKey := types.NamespacedName{Namespace: "default", Name: "pod1"}
+			c.checkDHCPBind(podKey, pod)
+			c.checkDHCPBind(podKey, pod)
+			recorder := c.recorder.(*record.FakeRecorder)
+			assert.Len(t, recorder.Events, test.wantEvents)
+			if test.wantEvents > 0 {
+				assert.Contains(t, <-recorder.Events, "DHCPNotBound")
+			}
+			// the warning is raised again for a new pod with the same name
+			c.forgetDHCPBind(podKey)
+			c.checkDHCPBind(podKey, pod)
+			assert.Len(t, recorder.Events, test.wantEvents)
+		})
+	}
+}
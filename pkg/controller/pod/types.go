@@ -13,11 +13,17 @@ const (
 	ADD    Operation = "add"
 	UPDATE Operation = "update"
 	DELETE Operation = "delete"
+	// FORCERENEW and RECONFIGURE push the changed options of Event.Subnet to the running guest
+	FORCERENEW  Operation = "forcerenew"
+	RECONFIGURE Operation = "reconfigure"
+	// LEASE refreshes the DHCPLease resources of the pod after a DHCP transaction
+	LEASE Operation = "lease"
 )
 
 type Event struct {
 	ObjKey    types.NamespacedName
 	Operation Operation
+	Subnet    string // subnet that triggered the event, empty for pod events
 }
 
 func (e Event) KeyString() string {
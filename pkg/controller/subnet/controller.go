@@ -30,6 +30,7 @@ type Controller struct {
 	queue        workqueue.RateLimitingInterface
 	dhcpV4       *dhcpv4.DHCPAllocator
 	dhcpV6       *dhcpv6.DHCPAllocator
+	duidStore    *dhcpv6.DUIDStore
 	metrics      *metrics.MetricsAllocator
 	recorder     record.EventRecorder
 	podNotify    podNotify
@@ -43,6 +44,7 @@ func NewController(
 	networkCache *cache2.NetworkCache,
 	dhcpV4 *dhcpv4.DHCPAllocator,
 	dhcpV6 *dhcpv6.DHCPAllocator,
+	duidStore *dhcpv6.DUIDStore,
 	metrics *metrics.MetricsAllocator,
 	recorder record.EventRecorder,
 ) *Controller {
@@ -69,6 +71,7 @@ func NewController(
 		queue:        queue,
 		dhcpV4:       dhcpV4,
 		dhcpV6:       dhcpV6,
+		duidStore:    duidStore,
 		metrics:      metrics,
 		networkCache: networkCache,
 		recorder:     recorder,
@@ -55,6 +55,16 @@ func filterSubnetGatewayChange(oldSubnet, newSubnet *kubeovnv1.Subnet) bool {
 	return oldSubnet.Spec.Gateway != newSubnet.Spec.Gateway
 }
 
+func filterSubnetHostnameChange(oldSubnet, newSubnet *kubeovnv1.Subnet) bool {
+	oldAnnotations, newAnnotations := oldSubnet.GetAnnotations(), newSubnet.GetAnnotations()
+	return oldAnnotations[util.AnnoDCloudDHCPHostname] != newAnnotations[util.AnnoDCloudDHCPHostname] ||
+		oldAnnotations[util.AnnoDCloudDHCPFQDNTemplate] != newAnnotations[util.AnnoDCloudDHCPFQDNTemplate]
+}
+
+func filterSubnetClientClassesChange(oldSubnet, newSubnet *kubeovnv1.Subnet) bool {
+	return oldSubnet.GetAnnotations()[util.AnnoDCloudDHCPClientClasses] != newSubnet.GetAnnotations()[util.AnnoDCloudDHCPClientClasses]
+}
+
 type SubnetEventHandler struct {
 	queue workqueue.RateLimitingInterface
 }
@@ -97,7 +107,9 @@ func (s *SubnetEventHandler) OnUpdate(oldObj, newObj interface{}) {
 		}
 	case filterSubnetDHCPChange(oldSubnet, newSubnet) ||
 		filterSubnetGatewayChange(oldSubnet, newSubnet) ||
-		filterSubnetCIDRChange(oldSubnet, newSubnet): // dhcpOptions or gateway or cidr changed
+		filterSubnetCIDRChange(oldSubnet, newSubnet) ||
+		filterSubnetHostnameChange(oldSubnet, newSubnet) ||
+		filterSubnetClientClassesChange(oldSubnet, newSubnet): // dhcpOptions or gateway or cidr or hostname or client classes changed
 		if filterSubnetProvider(newSubnet) { // provider matched
 			s.queue.Add(NewEvent(newSubnet, GetDHCPProvider(newSubnet), UPDATE)) // update dhcp options
 		}
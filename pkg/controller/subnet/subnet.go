@@ -3,9 +3,10 @@ package subnet
 import (
 	"context"
 	"fmt"
-	"reflect"
+	"net"
 	"slices"
 	"strings"
+	"time"
 
 	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	kubeovnv1 "github.com/kubeovn/kube-ovn/pkg/apis/kubeovn/v1"
@@ -40,8 +41,10 @@ func (c *Controller) handlerDHCPV4(subnet *kubeovnv1.Subnet, provider string, ne
 	oldOVNSubnet, ok := c.dhcpV4.GetSubnet(subnet.Name)
 	c.dhcpV4.AddOrUpdateSubnet(subnet.Name, *ovnSubnet)
 
-	if ok && !reflect.DeepEqual(oldOVNSubnet, *ovnSubnet) { // if update dhcpv4 options, send recorder event
+	if ok && !oldOVNSubnet.Equal(*ovnSubnet) { // if update dhcpv4 options, send recorder event
 		c.recorder.Event(subnet, corev1.EventTypeNormal, "DHCPServer", "DHCPv4 options updated successfully")
+		// push the changed options to the running guests
+		c.NotifyPods(subnet.Name, pod.FORCERENEW)
 	} else if !ok && provider != subnet.Spec.Provider {
 		msg := fmt.Sprintf("Add subnet to the dhcp privider <%s> DHCPv4 server", provider)
 		c.recorder.Event(subnet, corev1.EventTypeNormal, "DHCPServer", msg)
@@ -83,18 +86,25 @@ func (c *Controller) handlerDHCPV6(subnet *kubeovnv1.Subnet, provider string, ne
 	dhcpv6OptionsMap := util.ParseDHCPOptions(dhcpv6Options)
 
 	// 3. build ovn subnet
-	ovnSubnet, err := util.BuildOVNSubnetByIPV6Options(networkStatus, dhcpv6OptionsMap)
+	ovnSubnet, err := util.BuildOVNSubnetByIPV6Options(subnet, networkStatus, dhcpv6OptionsMap)
 	if err != nil {
 		c.recorder.Event(subnet, corev1.EventTypeWarning, "SubnetError", err.Error())
 		return err
 	}
+	// the server DUID is shared by all subnets of the network provider and persisted across replicas
+	serverMac, _ := net.ParseMAC(ovnSubnet.ServerMac)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ovnSubnet.ServerDUID = c.duidStore.GetOrCreate(ctx, provider, serverMac)
+	cancel()
 
 	// 4. add or update subnet
 	oldOVNSubnet, ok := c.dhcpV6.GetSubnet(subnet.Name)
 	c.dhcpV6.AddOrUpdateSubnet(subnet.Name, *ovnSubnet)
 
-	if ok && !reflect.DeepEqual(oldOVNSubnet, *ovnSubnet) { // if update dhcpv4 options, send recorder event
+	if ok && !oldOVNSubnet.Equal(*ovnSubnet) { // if update dhcpv4 options, send recorder event
 		c.recorder.Event(subnet, corev1.EventTypeNormal, "DHCPServer", "DHCPv6 options updated successfully")
+		// push the changed options to the running guests
+		c.NotifyPods(subnet.Name, pod.RECONFIGURE)
 	} else if !ok && provider != subnet.Spec.Provider {
 		msg := fmt.Sprintf("Add subnet to the dhcp privider <%s> DHCPv6 server", provider)
 		c.recorder.Event(subnet, corev1.EventTypeNormal, "DHCPServer", msg)
@@ -166,23 +176,43 @@ func (c *Controller) CreateOrUpdateDHCPServer(ctx context.Context, subnet *kubeo
 	return nil
 }
 
-// Insert all pods of the relevant subnet into the queue for coordination
-func (c *Controller) NotifyPods(subnetName string) {
-	notifyPodKeys := sets.New[types.NamespacedName]()
-	podKeys, _ := c.dhcpV4.GetPodKeys(subnetName)
-	key, _ := c.dhcpV6.GetPodKeys(subnetName)
-	podKeys = append(podKeys, key...)
+// Insert all pods of the relevant subnet into the queue for coordination,
+// the pods are updated unless other operations are given.
+// A FORCERENEW only goes to the DHCPv4 lease holders and a RECONFIGURE to the DHCPv6 lease holders.
+func (c *Controller) NotifyPods(subnetName string, operations ...pod.Operation) {
+	if len(operations) == 0 {
+		operations = []pod.Operation{pod.UPDATE}
+	}
+	v4PodKeys, _ := c.dhcpV4.GetPodKeys(subnetName)
+	v6PodKeys, _ := c.dhcpV6.GetPodKeys(subnetName)
+	for _, operation := range operations {
+		var podKeys []string
+		switch operation {
+		case pod.FORCERENEW:
+			podKeys = v4PodKeys
+		case pod.RECONFIGURE:
+			podKeys = v6PodKeys
+		default:
+			podKeys = append(slices.Clone(v4PodKeys), v6PodKeys...)
+		}
+		for podKey := range namespacedNames(podKeys) {
+			c.podNotify.EnQueue(pod.Event{ObjKey: podKey, Operation: operation, Subnet: subnetName})
+		}
+	}
+}
+
+// namespacedNames Returns the set of the "namespace/name" pod keys
+func namespacedNames(podKeys []string) sets.Set[types.NamespacedName] {
+	names := sets.New[types.NamespacedName]()
 	for _, podKey := range podKeys {
 		if split := strings.Split(podKey, string(types.Separator)); len(split) == 2 {
-			notifyPodKeys.Insert(types.NamespacedName{
+			names.Insert(types.NamespacedName{
 				Name:      split[1],
 				Namespace: split[0],
 			})
 		}
 	}
-	for podKey := range notifyPodKeys {
-		c.podNotify.EnQueue(pod.Event{ObjKey: podKey, Operation: pod.UPDATE})
-	}
+	return names
 }
 
 func (c *Controller) DeleteNetworkProvider(ctx context.Context, subnetKey types.NamespacedName, subnet *kubeovnv1.Subnet, provider string) error {
@@ -0,0 +1,58 @@
+package dhcp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// HostnameData The values available to the FQDN template,
+// example: {{.VM}}.{{.Namespace}}.vm.example.com
+type HostnameData struct {
+	VM        string // virtual machine name
+	Namespace string // virtual machine namespace
+	Subnet    string // kube-ovn subnet name
+}
+
+var templateCache sync.Map // template text -> *template.Template
+
+// ParseFQDNTemplate Parse and cache the FQDN template
+func ParseFQDNTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := templateCache.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("fqdn").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// RenderHostname Returns the hostname and FQDN of the virtual machine.
+// The FQDN is rendered from fqdnTemplate if present, otherwise it is
+// the hostname followed by domainName. An empty FQDN means that none is available.
+func RenderHostname(vmKey, subnetKey, fqdnTemplate, domainName string) (string, string, error) {
+	namespace, name, found := strings.Cut(vmKey, "/")
+	if !found || name == "" {
+		return "", "", fmt.Errorf("invalid vm key <%s>", vmKey)
+	}
+	if fqdnTemplate == "" {
+		if domainName == "" {
+			return name, "", nil
+		}
+		return name, name + "." + domainName, nil
+	}
+	tmpl, err := ParseFQDNTemplate(fqdnTemplate)
+	if err != nil {
+		return name, "", err
+	}
+	var buf bytes.Buffer
+	data := HostnameData{VM: name, Namespace: namespace, Subnet: subnetKey}
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return name, "", err
+	}
+	return name, strings.TrimSuffix(buf.String(), "."), nil
+}
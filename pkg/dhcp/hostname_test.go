@@ -0,0 +1,59 @@
+package dhcp
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RenderHostname(t *testing.T) {
+	tests := []struct {
+		vmKey        string
+		fqdnTemplate string
+		domainName   string
+		wantHostname string
+		wantFQDN     string
+		wantErr      bool
+	}{
+		{
+			vmKey:        "default/vm1",
+			wantHostname: "vm1",
+		},
+		{
+			vmKey:        "default/vm1",
+			domainName:   "example.com",
+			wantHostname: "vm1",
+			wantFQDN:     "vm1.example.com",
+		},
+		{
+			vmKey:        "tenant/vm1",
+			fqdnTemplate: "{{.VM}}.{{.Namespace}}.vm.example.com",
+			domainName:   "example.com",
+			wantHostname: "vm1",
+			wantFQDN:     "vm1.tenant.vm.example.com",
+		},
+		{
+			vmKey:        "tenant/vm1",
+			fqdnTemplate: "{{.Unknown}}.example.com",
+			wantHostname: "vm1",
+			wantErr:      true,
+		},
+		{
+			vmKey:   "vm1",
+			wantErr: true,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			hostname, fqdn, err := RenderHostname(test.vmKey, "subnet1", test.fqdnTemplate, test.domainName)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantHostname, hostname)
+			assert.Equal(t, test.wantFQDN, fqdn)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package dhcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// StoredLease persisted lease of a hardware address
+type StoredLease struct {
+	HWAddr    string   `json:"hwAddr"`
+	PodKeys   []string `json:"podKeys"`
+	ClientIP  net.IP   `json:"clientIP,omitempty"`
+	SubnetKey string   `json:"subnetKey"`
+	VMKey     string   `json:"vmKey,omitempty"`
+	Prefix    string   `json:"prefix,omitempty"` // DHCPv6 delegated prefix
+	// Status runtime status of the lease as of its last binding, release or decline, nil if unknown.
+	// The renewals are not written, the expiry time may lag behind
+	Status *LeaseStatus `json:"status,omitempty"`
+}
+
+// LeaseStore Persist the leases of an allocator, so that a new leader or a restarted
+// controller answers DHCP requests before the pod informer has been processed
+type LeaseStore interface {
+	// Save create or replace the lease of the hardware address
+	Save(lease StoredLease) error
+	// Delete remove the lease of the hardware address, a missing lease is not an error
+	Delete(hwAddr string) error
+	// List returns all persisted leases
+	List() ([]StoredLease, error)
+}
+
+// LeaseWriter Persist the lease changes of an allocator in the background, so that the DHCP handlers and the
+// pod controller never wait for the store. The writes of a hardware address are coalesced and never run
+// concurrently, and each write reads the current lease, so the store always ends up with the latest lease.
+type LeaseWriter struct {
+	store    LeaseStore
+	snapshot func(hwAddr string) (StoredLease, bool)
+	queue    workqueue.RateLimitingInterface
+}
+
+// NewLeaseWriter snapshot returns the current lease of the hardware address, false if no pod holds it anymore
+func NewLeaseWriter(store LeaseStore, snapshot func(hwAddr string) (StoredLease, bool)) *LeaseWriter {
+	return &LeaseWriter{
+		store:    store,
+		snapshot: snapshot,
+		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+}
+
+// Enqueue Schedule the write of the leases of the hardware addresses
+func (w *LeaseWriter) Enqueue(hwAddrs ...string) {
+	for _, hwAddr := range hwAddrs {
+		w.queue.Add(hwAddr)
+	}
+}
+
+// Run Write the scheduled leases until the context is done, the pending writes are dropped
+// as the next leader rebuilds the leases from the pods anyway
+func (w *LeaseWriter) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		w.queue.ShutDown()
+	}()
+	for w.processNextItem() {
+	}
+}
+
+func (w *LeaseWriter) processNextItem() bool {
+	key, quit := w.queue.Get()
+	if quit {
+		return false
+	}
+	defer w.queue.Done(key)
+
+	hwAddr := key.(string)
+	var err error
+	if lease, ok := w.snapshot(hwAddr); ok {
+		err = w.store.Save(lease)
+	} else {
+		err = w.store.Delete(hwAddr)
+	}
+	if err != nil {
+		log.Errorf("(dhcp.processNextItem) Cannot persist lease of hardware address <%s>: %v", hwAddr, err)
+		w.queue.AddRateLimited(hwAddr)
+		return true
+	}
+	w.queue.Forget(hwAddr)
+	return true
+}
+
+// LeaseStoreConfigMapPrefix name prefix of the ConfigMap shards, <prefix>-<name>-<shard>
+const LeaseStoreConfigMapPrefix = "dcloud-dhcp-controller-leases"
+
+// DefaultLeaseStoreShards number of ConfigMaps the leases are spread over, a ConfigMap holds at most 1MiB
+const DefaultLeaseStoreShards = 16
+
+// ConfigMapLeaseStore Persist the leases in ConfigMap shards, the shard of a lease is the hash of its hardware address
+type ConfigMapLeaseStore struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+	shards     int
+}
+
+// NewConfigMapLeaseStore name distinguishes the stores sharing the namespace, example: v4, v6
+func NewConfigMapLeaseStore(kubeClient kubernetes.Interface, namespace, name string, shards int) *ConfigMapLeaseStore {
+	if shards <= 0 {
+		shards = DefaultLeaseStoreShards
+	}
+	return &ConfigMapLeaseStore{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		name:       name,
+		shards:     shards,
+	}
+}
+
+func (s *ConfigMapLeaseStore) shardName(hwAddr string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hwAddr))
+	return s.shardNameByIndex(int(h.Sum32() % uint32(s.shards)))
+}
+
+func (s *ConfigMapLeaseStore) shardNameByIndex(index int) string {
+	return fmt.Sprintf("%s-%s-%d", LeaseStoreConfigMapPrefix, s.name, index)
+}
+
+// leaseConfigMapKey ConfigMap keys only allow alphanumerics, '-', '_' and '.'
+func leaseConfigMapKey(hwAddr string) string {
+	return strings.ReplaceAll(hwAddr, ":", "-")
+}
+
+func (s *ConfigMapLeaseStore) Save(lease StoredLease) error {
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	name, key := s.shardName(lease.HWAddr), leaseConfigMapKey(lease.HWAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: s.namespace},
+				Data:       map[string]string{key: string(value)},
+			}
+			_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		if cm.Data[key] == string(value) {
+			return nil
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = string(value)
+		_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (s *ConfigMapLeaseStore) Delete(hwAddr string) error {
+	name, key := s.shardName(hwAddr), leaseConfigMapKey(hwAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, ok := cm.Data[key]; !ok {
+			return nil
+		}
+		delete(cm.Data, key)
+		_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (s *ConfigMapLeaseStore) List() ([]StoredLease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var leases []StoredLease
+	for i := 0; i < s.shards; i++ {
+		name := s.shardNameByIndex(i)
+		cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for key, value := range cm.Data {
+			var lease StoredLease
+			if err := json.Unmarshal([]byte(value), &lease); err != nil {
+				log.Warnf("(dhcp.List) Invalid lease <%s> in ConfigMap <%s>, skip it: %v", key, name, err)
+				continue
+			}
+			leases = append(leases, lease)
+		}
+	}
+	return leases, nil
+}
+
+// BoltLeaseStore Persist the leases in a bucket of a local bbolt file,
+// the file must be on a volume that outlives the pod to survive restarts
+type BoltLeaseStore struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// OpenBoltDB Open the bbolt file shared by the lease stores, a file can only be opened once
+func OpenBoltDB(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+}
+
+// NewBoltLeaseStore bucket distinguishes the stores sharing the file, example: v4, v6
+func NewBoltLeaseStore(db *bolt.DB, bucket string) (*BoltLeaseStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create bucket <%s>: %v", bucket, err)
+	}
+	return &BoltLeaseStore{db: db, bucket: []byte(bucket)}, nil
+}
+
+func (s *BoltLeaseStore) Save(lease StoredLease) error {
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(lease.HWAddr), value)
+	})
+}
+
+func (s *BoltLeaseStore) Delete(hwAddr string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(hwAddr))
+	})
+}
+
+func (s *BoltLeaseStore) List() ([]StoredLease, error) {
+	var leases []StoredLease
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).ForEach(func(key, value []byte) error {
+			var lease StoredLease
+			if err := json.Unmarshal(value, &lease); err != nil {
+				log.Warnf("(dhcp.List) Invalid lease <%s> in bucket <%s>, skip it: %v", key, s.bucket, err)
+				return nil
+			}
+			leases = append(leases, lease)
+			return nil
+		})
+	})
+	return leases, err
+}
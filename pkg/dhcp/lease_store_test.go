@@ -0,0 +1,103 @@
+package dhcp
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_LeaseStore(t *testing.T) {
+	db, err := OpenBoltDB(filepath.Join(t.TempDir(), "leases.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	boltStore, err := NewBoltLeaseStore(db, "v4")
+	assert.NoError(t, err)
+
+	tests := []LeaseStore{
+		boltStore,
+		NewConfigMapLeaseStore(fake.NewSimpleClientset(), "dcloud", "v4", 4),
+	}
+	for i, store := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			lease1 := StoredLease{
+				HWAddr:    "52:54:00:00:00:01",
+				PodKeys:   []string{"default/pod1"},
+				ClientIP:  net.ParseIP("10.0.0.10"),
+				SubnetKey: "subnet1",
+				VMKey:     "default/vm1",
+			}
+			lease2 := StoredLease{
+				HWAddr:    "52:54:00:00:00:02",
+				PodKeys:   []string{"default/pod2", "default/pod3"},
+				ClientIP:  net.ParseIP("fd00::10"),
+				SubnetKey: "subnet2",
+				Prefix:    "fd00:1::/64",
+			}
+			assert.NoError(t, store.Save(lease1))
+			assert.NoError(t, store.Save(lease2))
+			// saving an unchanged lease is a no-op
+			assert.NoError(t, store.Save(lease2))
+
+			leases, err := store.List()
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []StoredLease{lease1, lease2}, leases)
+
+			assert.NoError(t, store.Delete(lease1.HWAddr))
+			assert.NoError(t, store.Delete("52:54:00:00:00:03"))
+			leases, err = store.List()
+			assert.NoError(t, err)
+			assert.Equal(t, []StoredLease{lease2}, leases)
+		})
+	}
+}
+
+func Test_LeaseWriter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	store := NewConfigMapLeaseStore(fake.NewSimpleClientset(), "dcloud", "v4", 4)
+
+	var mutex sync.Mutex
+	leases := map[string]StoredLease{}
+	setLease := func(lease StoredLease, ok bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if ok {
+			leases[lease.HWAddr] = lease
+		} else {
+			delete(leases, lease.HWAddr)
+		}
+	}
+	writer := NewLeaseWriter(store, func(hwAddr string) (StoredLease, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		lease, ok := leases[hwAddr]
+		return lease, ok
+	})
+	go writer.Run(ctx)
+
+	// the write reads the lease when it runs, the last change wins whatever the scheduling order
+	lease := StoredLease{HWAddr: "52:54:00:00:00:01", PodKeys: []string{"default/pod1"}, ClientIP: net.ParseIP("10.0.0.10")}
+	setLease(lease, true)
+	writer.Enqueue(lease.HWAddr)
+	lease.PodKeys = []string{"default/pod2"}
+	setLease(lease, true)
+	writer.Enqueue(lease.HWAddr)
+	assert.Eventually(t, func() bool {
+		stored, err := store.List()
+		return err == nil && assert.ObjectsAreEqual([]StoredLease{lease}, stored)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	setLease(lease, false)
+	writer.Enqueue(lease.HWAddr)
+	assert.Eventually(t, func() bool {
+		stored, err := store.List()
+		return err == nil && len(stored) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
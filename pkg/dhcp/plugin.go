@@ -0,0 +1,115 @@
+package dhcp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Handler a step of the reply pipeline, it modifies the reply held by the context c,
+// returning true stops the chain and drops the reply
+type Handler[C any] func(c C) (stop bool)
+
+// Plugin a named handler of the reply pipeline, similar to the coredhcp plugins
+type Plugin[C any] struct {
+	Name    string
+	Handler Handler[C]
+	// Optional not part of the default chain, the subnet must enable it explicitly
+	Optional bool
+}
+
+// Registry ordered plugins of a DHCP server, the registration order is the default chain order.
+// Forks can register their own plugins from an init function without touching the handlers.
+type Registry[C any] struct {
+	mutex   sync.RWMutex
+	plugins []Plugin[C]
+}
+
+// Register Append the plugin to the registry, the name must be unique
+func (r *Registry[C]) Register(plugin Plugin[C]) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if plugin.Name == "" || strings.ContainsAny(plugin.Name, "-,; ") || plugin.Handler == nil {
+		return fmt.Errorf("invalid plugin <%s>", plugin.Name)
+	}
+	if slices.ContainsFunc(r.plugins, func(p Plugin[C]) bool { return p.Name == plugin.Name }) {
+		return fmt.Errorf("plugin <%s> is already registered", plugin.Name)
+	}
+	r.plugins = append(r.plugins, plugin)
+	return nil
+}
+
+// MustRegister Register the plugin, panics on error, for init functions
+func (r *Registry[C]) MustRegister(plugin Plugin[C]) {
+	if err := r.Register(plugin); err != nil {
+		panic(err)
+	}
+}
+
+// Chain Returns the plugins of a subnet:
+//   - no names: the default chain, the non optional plugins in registration order
+//   - only -<name> entries: the default chain without these plugins
+//   - otherwise the named plugins in the given order, optional plugins included
+func (r *Registry[C]) Chain(names []string) ([]Plugin[C], error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var disabled []string
+	for _, name := range names {
+		if n, found := strings.CutPrefix(name, "-"); found {
+			disabled = append(disabled, n)
+		}
+	}
+	if len(disabled) > 0 && len(disabled) != len(names) {
+		return nil, fmt.Errorf("plugins must either all be disabled with '-' or be listed in order")
+	}
+	for _, name := range names {
+		if r.indexOf(strings.TrimPrefix(name, "-")) < 0 {
+			return nil, fmt.Errorf("unknown plugin <%s>", name)
+		}
+	}
+
+	var chain []Plugin[C]
+	if len(names) == 0 || len(disabled) > 0 {
+		for _, plugin := range r.plugins {
+			if !plugin.Optional && !slices.Contains(disabled, plugin.Name) {
+				chain = append(chain, plugin)
+			}
+		}
+		return chain, nil
+	}
+	for _, name := range names {
+		if slices.ContainsFunc(chain, func(p Plugin[C]) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("plugin <%s> is listed more than once", name)
+		}
+		chain = append(chain, r.plugins[r.indexOf(name)])
+	}
+	return chain, nil
+}
+
+func (r *Registry[C]) indexOf(name string) int {
+	return slices.IndexFunc(r.plugins, func(p Plugin[C]) bool { return p.Name == name })
+}
+
+// RunChain Run the plugins in order, returns false if a plugin stopped the chain
+func RunChain[C any](chain []Plugin[C], c C) bool {
+	for _, plugin := range chain {
+		if plugin.Handler(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePluginNames Parse the plugins option, example: plugins={dns;routes;hostname} or plugins={-netboot;-hostname}
+func ParsePluginNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
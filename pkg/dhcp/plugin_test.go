@@ -0,0 +1,73 @@
+package dhcp
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PluginChain(t *testing.T) {
+	registry := &Registry[*[]string]{}
+	for _, name := range []string{"dns", "routes", "hostname", "ratelimit"} {
+		registry.MustRegister(Plugin[*[]string]{
+			Name:     name,
+			Optional: name == "ratelimit",
+			Handler: func(c *[]string) bool {
+				*c = append(*c, name)
+				return name == "ratelimit"
+			},
+		})
+	}
+	assert.Error(t, registry.Register(Plugin[*[]string]{Name: "dns", Handler: func(*[]string) bool { return false }}))
+	assert.Error(t, registry.Register(Plugin[*[]string]{Name: "-dns", Handler: func(*[]string) bool { return false }}))
+
+	tests := []struct {
+		plugins  string
+		wantRun  []string
+		wantStop bool
+		wantErr  bool
+	}{
+		{
+			wantRun: []string{"dns", "routes", "hostname"},
+		},
+		{
+			plugins: "-routes",
+			wantRun: []string{"dns", "hostname"},
+		},
+		{
+			plugins: "hostname,dns",
+			wantRun: []string{"hostname", "dns"},
+		},
+		{
+			plugins:  "ratelimit,dns",
+			wantRun:  []string{"ratelimit"},
+			wantStop: true,
+		},
+		{
+			plugins: "dns,-routes",
+			wantErr: true,
+		},
+		{
+			plugins: "dns,dns",
+			wantErr: true,
+		},
+		{
+			plugins: "-unknown",
+			wantErr: true,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			chain, err := registry.Chain(ParsePluginNames(test.plugins))
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var run []string
+			assert.Equal(t, !test.wantStop, RunChain(chain, &run))
+			assert.Equal(t, test.wantRun, run)
+		})
+	}
+}
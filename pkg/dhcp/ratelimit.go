@@ -0,0 +1,70 @@
+package dhcp
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitBurst requests a client may send at once when the subnet sets rate_limit without rate_limit_burst
+const DefaultRateLimitBurst = 5
+
+// RateLimiter token buckets by client MAC, used by the ratelimit plugins to drop the requests
+// of guests flooding the server
+type RateLimiter struct {
+	mutex     sync.Mutex
+	rate      float64 // tokens added per second
+	burst     float64 // size of the buckets
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter Returns a limiter allowing rate requests per second with bursts of burst requests by client
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow Take a token from the bucket of the client, returns false if the bucket is empty
+func (l *RateLimiter) Allow(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep Forget the buckets refilled since the last request once a minute, a full bucket is the same as no bucket
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package dhcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	// the burst is allowed, then one request per second
+	assert.True(t, l.Allow("52:54:00:a1:b2:c3"))
+	assert.True(t, l.Allow("52:54:00:a1:b2:c3"))
+	assert.False(t, l.Allow("52:54:00:a1:b2:c3"))
+	// the buckets are per client
+	assert.True(t, l.Allow("52:54:00:a1:b2:c4"))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.False(t, l.Allow("52:54:00:a1:b2:c3"))
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("52:54:00:a1:b2:c3"))
+	assert.False(t, l.Allow("52:54:00:a1:b2:c3"))
+
+	// the refilled buckets are forgotten
+	now = now.Add(2 * time.Minute)
+	assert.True(t, l.Allow("52:54:00:a1:b2:c5"))
+	assert.Len(t, l.buckets, 1)
+}
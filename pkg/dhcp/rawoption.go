@@ -0,0 +1,168 @@
+package dhcp
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RawOptionPrefix prefix of the raw option keys in DHCPv4Options / DHCPv6Options,
+// example: option_42={ips:10.0.0.1;10.0.0.2}, option_2=int32:-3600, option_43=hex:01:04:c0:a8:00:01
+const RawOptionPrefix = "option_"
+
+// RawOption option sent verbatim to the clients
+type RawOption struct {
+	Code  uint16
+	Value []byte
+}
+
+// reservedRawOptions codes managed by the server that can not be overridden
+var (
+	reservedRawOptionsV4 = map[uint16]string{
+		0:   "pad",
+		53:  "message type",
+		54:  "server identifier",
+		82:  "relay agent information",
+		90:  "authentication",
+		255: "end",
+	}
+	reservedRawOptionsV6 = map[uint16]string{
+		1:  "client identifier",
+		2:  "server identifier",
+		3:  "IA_NA",
+		4:  "IA_TA",
+		5:  "IA address",
+		9:  "relay message",
+		11: "authentication",
+		13: "status code",
+		19: "reconfigure message",
+		20: "reconfigure accept",
+		25: "IA_PD",
+		26: "IA prefix",
+	}
+)
+
+// ParseRawOptions Parse all option_<code>=<type>:<value> entries of the options map.
+// The supported types are ip, ips, string, uint8, uint16, uint32, int32, hex and bool,
+// ip and ips values are encoded as IPv6 addresses when ipv6 is set.
+// The subnet options are split on ',' and ';' is turned into ',' and leading and trailing spaces are removed,
+// so string values containing ',' are rejected, use hex for strings with these characters.
+func ParseRawOptions(optionsMap map[string]string, ipv6 bool) ([]RawOption, error) {
+	var options []RawOption
+	for key, value := range optionsMap {
+		codeStr, found := strings.CutPrefix(key, RawOptionPrefix)
+		if !found {
+			continue
+		}
+		if data, ok := strings.CutPrefix(value, "string:"); ok && strings.Contains(data, ",") {
+			return nil, fmt.Errorf("invalid option <%s>: string value <%s> must not contain ',' or ';', use hex", key, data)
+		}
+		option, err := ParseRawOption(codeStr, value, ipv6)
+		if err != nil {
+			return nil, fmt.Errorf("invalid option <%s>: %v", key, err)
+		}
+		options = append(options, option)
+	}
+	// map iteration order is random, keep the result stable for comparisons
+	slices.SortFunc(options, func(a, b RawOption) int { return cmp.Compare(a.Code, b.Code) })
+	return options, nil
+}
+
+// ParseRawOption Parse the code and the <type>:<value> of a raw option
+func ParseRawOption(codeStr, value string, ipv6 bool) (RawOption, error) {
+	maxCode, reserved := uint64(254), reservedRawOptionsV4
+	if ipv6 {
+		maxCode, reserved = 65535, reservedRawOptionsV6
+	}
+	code, err := strconv.ParseUint(codeStr, 10, 16)
+	if err != nil || code == 0 || code > maxCode {
+		return RawOption{}, fmt.Errorf("option code must be between 1 and %d", maxCode)
+	}
+	if name, ok := reserved[uint16(code)]; ok {
+		return RawOption{}, fmt.Errorf("option %d (%s) is managed by the server", code, name)
+	}
+
+	b, err := ParseRawValue(value, ipv6)
+	if err != nil {
+		return RawOption{}, err
+	}
+	if !ipv6 && len(b) > 255 {
+		// longer values would need the RFC 3396 concatenation that many clients do not support
+		return RawOption{}, fmt.Errorf("value is longer than 255 bytes")
+	}
+	return RawOption{Code: uint16(code), Value: b}, nil
+}
+
+// ParseRawValue Encode a <type>:<value> string, also used for the sub-options of vendor options
+func ParseRawValue(value string, ipv6 bool) ([]byte, error) {
+	typ, data, found := strings.Cut(value, ":")
+	if !found {
+		return nil, fmt.Errorf("value <%s> must be <type>:<value>", value)
+	}
+	return encodeRawOption(typ, data, ipv6)
+}
+
+func encodeRawOption(typ, value string, ipv6 bool) ([]byte, error) {
+	switch typ {
+	case "ip", "ips":
+		var b []byte
+		for i, s := range strings.Split(value, ",") {
+			if typ == "ip" && i > 0 {
+				return nil, fmt.Errorf("type ip accepts a single address, use ips")
+			}
+			ip := net.ParseIP(s)
+			switch {
+			case ip == nil:
+				return nil, fmt.Errorf("invalid ip <%s>", s)
+			case ipv6 && ip.To4() == nil:
+				b = append(b, ip.To16()...)
+			case !ipv6 && ip.To4() != nil:
+				b = append(b, ip.To4()...)
+			default:
+				return nil, fmt.Errorf("ip <%s> does not match the address family", s)
+			}
+		}
+		return b, nil
+	case "string":
+		if value == "" {
+			return nil, fmt.Errorf("string value is empty")
+		}
+		return []byte(value), nil
+	case "uint8", "uint16", "uint32":
+		bitSize, _ := strconv.Atoi(strings.TrimPrefix(typ, "uint"))
+		n, err := strconv.ParseUint(value, 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s <%s>", typ, value)
+		}
+		b := binary.BigEndian.AppendUint32(nil, uint32(n))
+		return b[4-bitSize/8:], nil
+	case "int32":
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int32 <%s>", value)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(n))), nil
+	case "hex":
+		b, err := hex.DecodeString(strings.NewReplacer(":", "", ",", "").Replace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex <%s>", value)
+		}
+		return b, nil
+	case "bool":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool <%s>", value)
+		}
+		if v {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type <%s>", typ)
+	}
+}
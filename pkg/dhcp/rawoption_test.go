@@ -0,0 +1,112 @@
+package dhcp
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseRawOptions(t *testing.T) {
+	tests := []struct {
+		optionsMap  map[string]string
+		ipv6        bool
+		wantOptions []RawOption
+		wantErr     bool
+	}{
+		{
+			optionsMap: map[string]string{
+				"lease_time": "3600",
+				"option_7":   "ips:10.0.0.5,10.0.0.6",
+				"option_2":   "int32:-3600",
+				"option_66":  "string:tftp.example.com",
+				"option_43":  "hex:01:04:c0:a8:00:01",
+				"option_19":  "bool:false",
+				"option_23":  "uint8:64",
+				"option_57":  "uint16:1500",
+				"option_35":  "uint32:60",
+				"option_28":  "ip:10.0.0.255",
+			},
+			wantOptions: []RawOption{
+				{Code: 2, Value: []byte{0xff, 0xff, 0xf1, 0xf0}},
+				{Code: 7, Value: []byte{10, 0, 0, 5, 10, 0, 0, 6}},
+				{Code: 19, Value: []byte{0}},
+				{Code: 23, Value: []byte{64}},
+				{Code: 28, Value: []byte{10, 0, 0, 255}},
+				{Code: 35, Value: []byte{0, 0, 0, 60}},
+				{Code: 43, Value: []byte{1, 4, 0xc0, 0xa8, 0, 1}},
+				{Code: 57, Value: []byte{0x05, 0xdc}},
+				{Code: 66, Value: []byte("tftp.example.com")},
+			},
+		},
+		{
+			optionsMap: map[string]string{"option_22": "ips:2001:db8::53", "option_65001": "bool:true"},
+			ipv6:       true,
+			wantOptions: []RawOption{
+				{Code: 22, Value: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x53}},
+				{Code: 65001, Value: []byte{1}},
+			},
+		},
+		{
+			optionsMap: map[string]string{"dns_server": "8.8.8.8"},
+		},
+		{
+			optionsMap: map[string]string{"option_7": "ips:2001:db8::53"},
+			wantErr:    true,
+		},
+		{
+			// {a;b} is turned into a,b by the subnet options parser
+			optionsMap: map[string]string{"option_114": "string:https://portal.example.com/?a=1,b=2"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_22": "ip:10.0.0.1"},
+			ipv6:       true,
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_28": "ip:10.0.0.1,10.0.0.2"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_54": "ip:10.0.0.1"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_2": "ip:10.0.0.1"},
+			ipv6:       true,
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_300": "uint8:1"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_23": "uint8:256"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_23": "64"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_23": "float:1.5"},
+			wantErr:    true,
+		},
+		{
+			optionsMap: map[string]string{"option_43": "hex:0g"},
+			wantErr:    true,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			options, err := ParseRawOptions(test.optionsMap, test.ipv6)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantOptions, options)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package dhcp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Authentication option fields of the reconfigure key protocol (RFC 8415 20.4),
+// which is shared by the DHCPv4 forcerenew nonce protocol (RFC 6704)
+const (
+	AuthProtocolReconfigureKey = 3
+	AuthAlgorithmHMACMD5       = 1
+	AuthRDMMonotonicCounter    = 0
+
+	AuthTypeReconfigureKey  = 1 // the key / nonce, sent in a Reply or DHCPACK
+	AuthTypeHMACMD5         = 2 // the digest, sent in a Reconfigure or DHCPFORCERENEW
+	ReconfigureKeyLength    = 16
+	reconfigureAuthInfoSize = 1 + ReconfigureKeyLength
+	reconfigureAuthSize     = 3 + 8 + reconfigureAuthInfoSize
+)
+
+// replayDetection monotonic counter of the replay detection field, seeded with the start time
+// so that clients still accept the messages of a restarted controller
+var replayDetection atomic.Uint64
+
+func init() {
+	replayDetection.Store(uint64(time.Now().UnixNano()))
+}
+
+// NewReconfigureKey Returns a random reconfigure key (DHCPv6) or forcerenew nonce (DHCPv4)
+func NewReconfigureKey() ([]byte, error) {
+	key := make([]byte, ReconfigureKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("cannot generate reconfigure key: %v", err)
+	}
+	return key, nil
+}
+
+// ReconfigureKeyAuth Returns the authentication option value carrying the key to the client
+func ReconfigureKeyAuth(key []byte) []byte {
+	return reconfigureAuth(AuthTypeReconfigureKey, key)
+}
+
+// ReconfigureHMACAuth Returns the authentication option value of a reconfigure message,
+// the digest is zeroed and must be filled with SignReconfigure once the message is complete
+func ReconfigureHMACAuth() []byte {
+	return reconfigureAuth(AuthTypeHMACMD5, make([]byte, ReconfigureKeyLength))
+}
+
+func reconfigureAuth(authType byte, value []byte) []byte {
+	b := make([]byte, 0, reconfigureAuthSize)
+	b = append(b, AuthProtocolReconfigureKey, AuthAlgorithmHMACMD5, AuthRDMMonotonicCounter)
+	b = binary.BigEndian.AppendUint64(b, replayDetection.Add(1))
+	b = append(b, authType)
+	return append(b, value...)
+}
+
+// SignReconfigure Compute the HMAC-MD5 of the serialized message, which contains the authentication
+// option returned by ReconfigureHMACAuth, and write the digest into auth and the message
+func SignReconfigure(msg, auth, key []byte) error {
+	if len(auth) != reconfigureAuthSize {
+		return fmt.Errorf("invalid reconfigure authentication option length %d", len(auth))
+	}
+	offset := bytes.Index(msg, auth)
+	if offset < 0 {
+		return fmt.Errorf("reconfigure authentication option not found in message")
+	}
+	mac := hmac.New(md5.New, key)
+	mac.Write(msg)
+	digest := mac.Sum(nil)
+	copy(auth[reconfigureAuthSize-ReconfigureKeyLength:], digest)
+	copy(msg[offset:], auth)
+	return nil
+}
@@ -0,0 +1,54 @@
+package dhcp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SignReconfigure(t *testing.T) {
+	key, err := NewReconfigureKey()
+	assert.NoError(t, err)
+	assert.Len(t, key, ReconfigureKeyLength)
+
+	keyAuth := ReconfigureKeyAuth(key)
+	assert.Equal(t, []byte{AuthProtocolReconfigureKey, AuthAlgorithmHMACMD5, AuthRDMMonotonicCounter}, keyAuth[:3])
+	assert.Equal(t, byte(AuthTypeReconfigureKey), keyAuth[11])
+	assert.Equal(t, key, keyAuth[12:])
+
+	tests := []struct {
+		prefix []byte
+		suffix []byte
+	}{
+		{
+			prefix: []byte{10, 0, 0, 0},
+			suffix: []byte{0, 19, 0, 1, 5},
+		},
+		{
+			prefix: []byte{1, 2, 3},
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			auth := ReconfigureHMACAuth()
+			assert.Equal(t, byte(AuthTypeHMACMD5), auth[11])
+			assert.Greater(t, binary.BigEndian.Uint64(auth[3:11]), binary.BigEndian.Uint64(keyAuth[3:11]))
+
+			msg := append(append(bytes.Clone(test.prefix), auth...), test.suffix...)
+			unsigned := bytes.Clone(msg)
+			assert.NoError(t, SignReconfigure(msg, auth, key))
+
+			mac := hmac.New(md5.New, key)
+			mac.Write(unsigned)
+			assert.Equal(t, mac.Sum(nil), auth[12:])
+			assert.Equal(t, auth, msg[len(test.prefix):len(test.prefix)+len(auth)])
+		})
+	}
+
+	assert.Error(t, SignReconfigure([]byte{1, 2, 3}, ReconfigureHMACAuth(), key))
+}
@@ -0,0 +1,105 @@
+package dhcp
+
+import "time"
+
+// LeaseState lifecycle state of a lease as seen by the DHCP server
+type LeaseState string
+
+const (
+	LeaseStateAllocated LeaseState = "Allocated" // reserved for the pod, the guest has not asked for it yet
+	LeaseStateOffered   LeaseState = "Offered"
+	LeaseStateBound     LeaseState = "Bound"
+	LeaseStateRenewed   LeaseState = "Renewed"
+	LeaseStateExpired   LeaseState = "Expired" // bound but not renewed before the expiry time
+	LeaseStateReleased  LeaseState = "Released"
+	LeaseStateDeclined  LeaseState = "Declined"
+)
+
+// LeaseStatus runtime status of a lease, updated by the DHCP handlers
+type LeaseStatus struct {
+	State            LeaseState `json:"state"`
+	FirstOfferTime   time.Time  `json:"firstOfferTime"`
+	BoundTime        time.Time  `json:"boundTime"`     // start of the current binding
+	LastRenewTime    time.Time  `json:"lastRenewTime"` // last extension of the current binding
+	ExpiryTime       time.Time  `json:"expiryTime"`
+	LastDiscoverTime time.Time  `json:"lastDiscoverTime"`      // DHCPDISCOVER or DHCPv6 Solicit
+	LastRequestTime  time.Time  `json:"lastRequestTime"`       // DHCPREQUEST or DHCPv6 Request, Renew and Rebind
+	Hostname         string     `json:"hostname,omitempty"`    // host name option 12 or client FQDN sent by the guest
+	VendorClass      string     `json:"vendorClass,omitempty"` // vendor class identifier option 60 or DHCPv6 vendor class sent by the guest
+}
+
+// Initial Reports whether the guest has not sent any request for the lease yet,
+// or the status was lost, example: a new leader without lease store
+func (s LeaseStatus) Initial() bool {
+	return (s.State == "" || s.State == LeaseStateAllocated) && s.LastDiscoverTime.IsZero() && s.LastRequestTime.IsZero()
+}
+
+// StateAt Returns the state of the lease at the given time, a binding that was not renewed in time is expired
+func (s LeaseStatus) StateAt(now time.Time) LeaseState {
+	if s.bound() && !s.ExpiryTime.IsZero() && now.After(s.ExpiryTime) {
+		return LeaseStateExpired
+	}
+	return s.State
+}
+
+// StateChanged Reports whether the status moved to another state since the previous status,
+// the offers and renewals of an active binding only move the timestamps
+func (s LeaseStatus) StateChanged(previous LeaseStatus, now time.Time) bool {
+	return previous.StateAt(now) != s.State
+}
+
+// Persistent Reports whether the lease store keeps a lease moving to the state: a new binding, a release or a decline.
+// The offers and renewals are kept in memory, they would write the lease store on every transaction
+func (s LeaseState) Persistent() bool {
+	return s == LeaseStateBound || s == LeaseStateReleased || s == LeaseStateDeclined
+}
+
+func (s LeaseStatus) bound() bool {
+	return s.State == LeaseStateBound || s.State == LeaseStateRenewed
+}
+
+// Offer Record an offer of the lease, an active binding keeps its state
+func (s *LeaseStatus) Offer(now time.Time) {
+	s.LastDiscoverTime = now
+	if s.FirstOfferTime.IsZero() {
+		s.FirstOfferTime = now
+	}
+	if state := s.StateAt(now); state != LeaseStateBound && state != LeaseStateRenewed {
+		s.State = LeaseStateOffered
+	}
+}
+
+// Bind Record an acknowledged request, extending an active binding is a renewal
+func (s *LeaseStatus) Bind(now time.Time, leaseTime time.Duration) {
+	s.LastRequestTime = now
+	if state := s.StateAt(now); state == LeaseStateBound || state == LeaseStateRenewed {
+		s.State = LeaseStateRenewed
+		s.LastRenewTime = now
+	} else {
+		s.State = LeaseStateBound
+		s.BoundTime = now
+		s.LastRenewTime = time.Time{}
+	}
+	s.ExpiryTime = now.Add(leaseTime)
+}
+
+// Release Record the end of the binding by the guest
+func (s *LeaseStatus) Release(state LeaseState) {
+	s.State = state
+	s.ExpiryTime = time.Time{}
+}
+
+// SetClient Record the identification sent by the guest, empty values keep the previous ones
+func (s *LeaseStatus) SetClient(hostname, vendorClass string) {
+	if hostname != "" {
+		s.Hostname = hostname
+	}
+	if vendorClass != "" {
+		s.VendorClass = vendorClass
+	}
+}
+
+// LeaseNotify receives the pods holding a lease whose state changed
+type LeaseNotify interface {
+	NotifyLease(podKey string)
+}
@@ -0,0 +1,124 @@
+package dhcp
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LeaseStatus(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	leaseTime := time.Hour
+
+	tests := []struct {
+		steps  func(s *LeaseStatus)
+		at     time.Time
+		expect LeaseState
+	}{
+		{
+			steps:  func(s *LeaseStatus) {},
+			at:     start,
+			expect: LeaseStateAllocated,
+		},
+		{
+			steps:  func(s *LeaseStatus) { s.Offer(start) },
+			at:     start.Add(2 * leaseTime),
+			expect: LeaseStateOffered,
+		},
+		{
+			steps: func(s *LeaseStatus) {
+				s.Offer(start)
+				s.Bind(start.Add(time.Second), leaseTime)
+			},
+			at:     start.Add(time.Minute),
+			expect: LeaseStateBound,
+		},
+		{
+			steps: func(s *LeaseStatus) {
+				s.Bind(start, leaseTime)
+				s.Bind(start.Add(leaseTime/2), leaseTime)
+				// a reboot of the guest does not end the binding
+				s.Offer(start.Add(leaseTime))
+			},
+			at:     start.Add(leaseTime),
+			expect: LeaseStateRenewed,
+		},
+		{
+			steps:  func(s *LeaseStatus) { s.Bind(start, leaseTime) },
+			at:     start.Add(leaseTime + time.Second),
+			expect: LeaseStateExpired,
+		},
+		{
+			steps: func(s *LeaseStatus) {
+				s.Bind(start, leaseTime)
+				s.Release(LeaseStateReleased)
+			},
+			at:     start.Add(2 * leaseTime),
+			expect: LeaseStateReleased,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			s := LeaseStatus{State: LeaseStateAllocated}
+			test.steps(&s)
+			assert.Equal(t, test.expect, s.StateAt(test.at))
+		})
+	}
+
+	// an expired binding starts over
+	s := LeaseStatus{}
+	s.Offer(start)
+	s.Bind(start, leaseTime)
+	s.Bind(start.Add(leaseTime/2), leaseTime)
+	assert.Equal(t, start, s.BoundTime)
+	assert.Equal(t, start.Add(leaseTime/2), s.LastRenewTime)
+	s.Bind(start.Add(3*leaseTime), leaseTime)
+	assert.Equal(t, LeaseStateBound, s.State)
+	assert.Equal(t, start.Add(3*leaseTime), s.BoundTime)
+	assert.True(t, s.LastRenewTime.IsZero())
+	assert.Equal(t, start.Add(4*leaseTime), s.ExpiryTime)
+	assert.Equal(t, start, s.FirstOfferTime)
+
+	s.SetClient("vm1", "")
+	s.SetClient("", "PXEClient")
+	assert.Equal(t, "vm1", s.Hostname)
+	assert.Equal(t, "PXEClient", s.VendorClass)
+}
+
+func Test_LeaseStatusStateChanged(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	leaseTime := time.Hour
+
+	s := LeaseStatus{State: LeaseStateAllocated}
+	previous := s
+	s.Offer(start)
+	assert.True(t, s.StateChanged(previous, start))
+	assert.False(t, s.State.Persistent())
+	// a retransmitted offer
+	previous = s
+	s.Offer(start.Add(time.Second))
+	assert.False(t, s.StateChanged(previous, start.Add(time.Second)))
+	previous = s
+	s.Bind(start.Add(time.Second), leaseTime)
+	assert.True(t, s.StateChanged(previous, start.Add(time.Second)))
+	assert.True(t, s.State.Persistent())
+	previous = s
+	s.Bind(start.Add(leaseTime/2), leaseTime)
+	assert.True(t, s.StateChanged(previous, start.Add(leaseTime/2)))
+	assert.False(t, s.State.Persistent())
+	// the next renewals only move the expiry time
+	previous = s
+	s.Bind(start.Add(leaseTime), leaseTime)
+	assert.False(t, s.StateChanged(previous, start.Add(leaseTime)))
+	// a new binding after the expiry
+	previous = s
+	s.Bind(start.Add(3*leaseTime), leaseTime)
+	assert.True(t, s.StateChanged(previous, start.Add(3*leaseTime)))
+	assert.True(t, s.State.Persistent())
+	previous = s
+	s.Release(LeaseStateReleased)
+	assert.True(t, s.StateChanged(previous, start.Add(3*leaseTime)))
+	assert.True(t, s.State.Persistent())
+}
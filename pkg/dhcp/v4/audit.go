@@ -0,0 +1,20 @@
+package v4
+
+import (
+	"tydic.io/dcloud-dhcp-controller/pkg/audit"
+)
+
+// SetAuditLogger Write an audit record for every transaction, nil disables the audit log
+func (a *DHCPAllocator) SetAuditLogger(logger *audit.Logger) {
+	a.mutex.Lock()
+	a.audit = logger
+	a.mutex.Unlock()
+}
+
+// beginAudit Start the audit record of a request received on the nic
+func (a *DHCPAllocator) beginAudit(nic string) *audit.Transaction {
+	a.mutex.RLock()
+	logger := a.audit
+	a.mutex.RUnlock()
+	return logger.Begin(audit.ProtocolDHCPv4, nic)
+}
@@ -0,0 +1,55 @@
+package v4
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// ClientClass options sent to the clients matching all the conditions of the class,
+// they override the subnet options
+type ClientClass struct {
+	Name        string
+	VendorClass string           // prefix of the vendor class identifier option 60, example: PXEClient
+	UserClass   string           // one of the user classes of option 77, example: iPXE
+	MACPrefix   []byte           // prefix of the client hardware address, example: the OUI 52:54:00
+	RawOptions  []dhcp.RawOption // options of the class
+	VendorInfo  []byte           // vendor specific information option 43
+}
+
+// Match The client matches all the conditions of the class
+func (c ClientClass) Match(m *dhcpv4.DHCPv4) bool {
+	if c.VendorClass != "" && !strings.HasPrefix(m.ClassIdentifier(), c.VendorClass) {
+		return false
+	}
+	if c.UserClass != "" && !slices.Contains(m.UserClass(), c.UserClass) {
+		return false
+	}
+	if len(c.MACPrefix) > 0 && !bytes.HasPrefix(m.ClientHWAddr, c.MACPrefix) {
+		return false
+	}
+	return true
+}
+
+// MatchClientClass Returns the first client class of the subnet matched by the client
+func (s OVNSubnet) MatchClientClass(m *dhcpv4.DHCPv4) (ClientClass, bool) {
+	for _, class := range s.ClientClasses {
+		if class.Match(m) {
+			return class, true
+		}
+	}
+	return ClientClass{}, false
+}
+
+// setClientClassOptions Override the subnet options with the options of the client class
+func setClientClassOptions(reply *dhcpv4.DHCPv4, class ClientClass) {
+	for _, option := range class.RawOptions {
+		reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(option.Code), option.Value))
+	}
+	if len(class.VendorInfo) > 0 {
+		reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, class.VendorInfo))
+	}
+}
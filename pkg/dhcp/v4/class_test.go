@@ -0,0 +1,61 @@
+package v4
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MatchClientClass(t *testing.T) {
+	subnet := OVNSubnet{
+		ClientClasses: []ClientClass{
+			{Name: "ipxe", UserClass: "iPXE"},
+			{Name: "pxe", VendorClass: "PXEClient"},
+			{Name: "vnf", VendorClass: "vnf", MACPrefix: []byte{0x52, 0x54, 0x00}},
+		},
+	}
+	tests := []struct {
+		mac       string
+		modifiers []dhcpv4.Modifier
+		wantClass string
+	}{
+		{
+			mac:       "52:54:00:00:00:01",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016"))},
+			wantClass: "pxe",
+		},
+		{
+			mac: "52:54:00:00:00:01",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithUserClass("iPXE", true),
+			},
+			wantClass: "ipxe",
+		},
+		{
+			mac:       "52:54:00:00:00:01",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier("vnf"))},
+			wantClass: "vnf",
+		},
+		{
+			mac:       "00:16:3e:00:00:01",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier("vnf"))},
+		},
+		{
+			mac: "52:54:00:00:00:01",
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			mac, _ := net.ParseMAC(test.mac)
+			m, err := dhcpv4.New(append(test.modifiers, dhcpv4.WithHwAddr(mac))...)
+			assert.NoError(t, err)
+			class, ok := subnet.MatchClientClass(m)
+			assert.Equal(t, test.wantClass != "", ok)
+			assert.Equal(t, test.wantClass, class.Name)
+		})
+	}
+}
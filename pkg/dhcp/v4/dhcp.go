@@ -6,29 +6,107 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/insomniacslk/dhcp/rfc1035label"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"tydic.io/dcloud-dhcp-controller/pkg/audit"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	"tydic.io/dcloud-dhcp-controller/pkg/metrics"
+)
+
+// OptionMSClasslessStaticRoute Microsoft classless static route option, same format as option 121
+const OptionMSClasslessStaticRoute = dhcpv4.GenericOptionCode(249)
+
+// RFC 4702 client FQDN option flags
+const (
+	fqdnFlagS uint8 = 1 << iota // server should perform the A RR update
+	fqdnFlagO                   // server has overridden the client S bit
+	fqdnFlagE                   // domain name is in canonical wire format
+	fqdnFlagN                   // server should not perform any DNS update
 )
 
 type OVNSubnet struct {
-	ServerMac  string // dhcp server mac
-	ServerIP   net.IP // dhcp server ip
+	ServerMac  string     // dhcp server mac
+	ServerIP   net.IP     // dhcp server ip
+	CIDR       *net.IPNet // ipv4 cidr of the subnet, used to validate relayed requests
 	SubnetMask net.IPMask
 	MTU        uint32
 	Routers    []net.IP // default router=$ipv4_gateway
 	NTP        []net.IP
 	DNS        []net.IP
 	LeaseTime  int // dhcp lease time (second), default: 3600
+	// RenewalTime option 58 T1 (second), default: 0, the client uses 0.5 * lease time
+	RenewalTime int
+	// RebindingTime option 59 T2 (second), default: 0, the client uses 0.875 * lease time
+	RebindingTime int
+	// DomainName option 15
+	DomainName string
+	// DomainSearch option 119
+	DomainSearch []string
+	// ClasslessStaticRoutes option 121 and microsoft option 249
+	ClasslessStaticRoutes []*dhcpv4.Route
+	// Hostname send the virtual machine name as option 12 and answer option 81
+	Hostname bool
+	// FQDNTemplate template of the client FQDN, default: <hostname>.<domain name>
+	FQDNTemplate string
+	// Authoritative NAK requests for addresses that are not leased to the client,
+	// so that the guest moves to the new address promptly
+	Authoritative bool
+	// NetBoot PXE boot parameters
+	NetBoot NetBoot
+	// RawOptions option_<code> options sent verbatim, they override the options above
+	RawOptions []dhcp.RawOption
+	// ClientClasses options by vendor class, user class or MAC prefix, they override the subnet options
+	ClientClasses []ClientClass
+	// Plugins names of the reply plugins, nil means the default chain, see Plugins
+	Plugins []string
+	// Chain the reply plugins selected by Plugins, built once with the subnet
+	Chain []dhcp.Plugin[*PluginContext]
+	// RateLimit requests per second accepted from each client by the ratelimit plugin
+	RateLimit float64
+	// RateLimitBurst requests accepted at once from each client by the ratelimit plugin
+	RateLimitBurst int
+	// RateLimiter token buckets of the ratelimit plugin, nil if the subnet has no rate limit
+	RateLimiter *dhcp.RateLimiter
+}
+
+// Equal Reports whether the subnets have the same options, the built chain and the rate limiter state are not compared
+func (s OVNSubnet) Equal(o OVNSubnet) bool {
+	s.Chain, o.Chain = nil, nil
+	s.RateLimiter, o.RateLimiter = nil, nil
+	return reflect.DeepEqual(s, o)
+}
+
+// NetBoot PXE / iPXE boot parameters of a subnet
+type NetBoot struct {
+	NextServer     net.IP               // siaddr, default: dhcp server ip
+	TFTPServerName string               // sname and option 66
+	BootFile       string               // file and option 67, used when no architecture specific file matches
+	ArchBootFiles  map[iana.Arch]string // boot file by client system architecture option 93
+	IPXEBootFile   string               // boot file for the iPXE chain-loading phase, detected by user class option 77
+	HTTPBootURL    string               // boot file url for the UEFI HTTP boot clients, detected by vendor class "HTTPClient"
+}
+
+func (n NetBoot) Enabled() bool {
+	return n.BootFile != "" || len(n.ArchBootFiles) > 0 || n.IPXEBootFile != "" || n.HTTPBootURL != ""
 }
 
 type DHCPLease struct {
 	ClientIP  net.IP
 	SubnetKey string
+	VMKey     string // namespace/name of the virtual machine holding the lease
+	Status    dhcp.LeaseStatus
 }
 
 type DHCPServer struct {
@@ -49,14 +127,21 @@ type DHCPAllocator struct {
 	podkeySubnets map[string]sets.String // PodKey    -> SubnetKeys mapping
 
 	servers map[string]DHCPServer
+	nonces  map[string]forceRenewNonce // Mac -> forcerenew nonce
+	notify  dhcp.LeaseNotify
+	audit   *audit.Logger
+	writer  *dhcp.LeaseWriter // nil keeps the leases in memory only
 	mutex   sync.RWMutex
+
+	metrics  *metrics.MetricsAllocator
+	recorder record.EventRecorder
 }
 
-func New(ctx context.Context) *DHCPAllocator {
-	return NewDHCPAllocator(ctx)
+func New(ctx context.Context, metrics *metrics.MetricsAllocator, recorder record.EventRecorder) *DHCPAllocator {
+	return NewDHCPAllocator(ctx, metrics, recorder)
 }
 
-func NewDHCPAllocator(ctx context.Context) *DHCPAllocator {
+func NewDHCPAllocator(ctx context.Context, metrics *metrics.MetricsAllocator, recorder record.EventRecorder) *DHCPAllocator {
 	subnets := make(map[string]OVNSubnet)
 	leases := make(map[string]DHCPLease)
 	macPodKeys := make(map[string]sets.String)
@@ -74,6 +159,9 @@ func NewDHCPAllocator(ctx context.Context) *DHCPAllocator {
 		subnetPodKeys: subnetPodKeys,
 		podkeySubnets: podkeySubnets,
 		servers:       servers,
+		nonces:        make(map[string]forceRenewNonce),
+		metrics:       metrics,
+		recorder:      recorder,
 	}
 }
 
@@ -88,7 +176,12 @@ func (a *DHCPAllocator) AddOrUpdateSubnet(subnetKey string, subnet OVNSubnet) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	_, ok := a.subnets[subnetKey]
+	old, ok := a.subnets[subnetKey]
+	if ok && old.RateLimiter != nil && subnet.RateLimiter != nil &&
+		old.RateLimit == subnet.RateLimit && old.RateLimitBurst == subnet.RateLimitBurst {
+		// keep the token buckets of the clients on resync
+		subnet.RateLimiter = old.RateLimiter
+	}
 	a.subnets[subnetKey] = subnet
 
 	if ok {
@@ -150,10 +243,23 @@ func (a *DHCPAllocator) HasPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLea
 	if !existLease {
 		return false
 	}
+	// the runtime status is not part of the pod lease
+	lease.Status = dhcpLease.Status
 	return reflect.DeepEqual(lease, dhcpLease)
 }
 
 func (a *DHCPAllocator) AddPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLease) error {
+	if a.HasPodDHCPLease(hwAddr, podKey, dhcpLease) {
+		return nil
+	}
+	if err := a.addPodDHCPLease(hwAddr, podKey, dhcpLease); err != nil {
+		return err
+	}
+	a.persistLeases(hwAddr)
+	return nil
+}
+
+func (a *DHCPAllocator) addPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLease) error {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
@@ -174,6 +280,11 @@ func (a *DHCPAllocator) AddPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLea
 		return fmt.Errorf("hwaddr <%s> is not valid", hwAddr)
 	}
 
+	if lease, ok := a.leases[hwAddr]; ok && lease.ClientIP.Equal(dhcpLease.ClientIP) {
+		dhcpLease.Status = lease.Status
+	} else {
+		dhcpLease.Status = dhcp.LeaseStatus{State: dhcp.LeaseStateAllocated}
+	}
 	a.leases[hwAddr] = dhcpLease
 
 	// add mac to podKeys mapping
@@ -217,6 +328,41 @@ func (a *DHCPAllocator) GetPodMacAddress(podKey string) ([]string, bool) {
 	return nil, ok
 }
 
+func (a *DHCPAllocator) GetMacPodKeys(hwAddr string) ([]string, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	keySet, ok := a.macPodKeys[hwAddr]
+	if ok {
+		return keySet.List(), ok
+	}
+	return nil, ok
+}
+
+// GetSubnetByIP find the subnet whose cidr contains the given ip,
+// or whose server address shares the network with it if the cidr is unknown
+func (a *DHCPAllocator) GetSubnetByIP(ip net.IP) (string, OVNSubnet, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if ip == nil || ip.IsUnspecified() {
+		return "", OVNSubnet{}, false
+	}
+	for subnetKey, subnet := range a.subnets {
+		if subnet.CIDR != nil {
+			if subnet.CIDR.Contains(ip) {
+				return subnetKey, subnet, true
+			}
+			continue
+		}
+		if subnet.ServerIP == nil || subnet.SubnetMask == nil {
+			continue
+		}
+		if subnet.ServerIP.Mask(subnet.SubnetMask).Equal(ip.Mask(subnet.SubnetMask)) {
+			return subnetKey, subnet, true
+		}
+	}
+	return "", OVNSubnet{}, false
+}
+
 func (a *DHCPAllocator) GetPodKeys(subnetKey string) ([]string, bool) {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
@@ -228,6 +374,15 @@ func (a *DHCPAllocator) GetPodKeys(subnetKey string) ([]string, bool) {
 }
 
 func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
+	hwAddrs, _ := a.GetPodMacAddress(podKey)
+	if err := a.deletePodDHCPLease(podKey); err != nil {
+		return err
+	}
+	a.persistLeases(hwAddrs...)
+	return nil
+}
+
+func (a *DHCPAllocator) deletePodDHCPLease(podKey string) error {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
@@ -253,6 +408,7 @@ func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
 		if ok && keySet.Equal(sets.NewString(podKey)) {
 			delete(a.leases, macAddr)
 			delete(a.macPodKeys, macAddr)
+			delete(a.nonces, macAddr)
 			delMacList = append(delMacList, macAddr)
 		} else if ok {
 			a.macPodKeys[macAddr] = keySet.Delete(podKey)
@@ -276,38 +432,78 @@ func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
 	return nil
 }
 
-func (a *DHCPAllocator) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+func (a *DHCPAllocator) dhcpHandler(nic string, conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+	tx := a.beginAudit(nic)
+	defer tx.End()
+
 	if m == nil {
 		log.Errorf("(dhcpv4.dhcpHandler) packet is nil!")
+		tx.Drop("empty packet")
 		return
 	}
 
 	log.Tracef("(dhcpv4.dhcpHandler) INCOMING PACKET=%s", m.Summary())
 
+	mt := m.MessageType()
+	tx.MAC, tx.XID, tx.MessageType = m.ClientHWAddr.String(), m.TransactionID.String(), mt.String()
+
 	if m.OpCode != dhcpv4.OpcodeBootRequest {
 		log.Errorf("(dhcpv4.dhcpHandler) not a BootRequest!")
+		tx.Drop("not a BootRequest")
 		return
 	}
 
 	reply, err := dhcpv4.NewReplyFromRequest(m)
 	if err != nil {
 		log.Errorf("(dhcpv4.dhcpHandler) NewReplyFromRequest failed: %v", err)
+		tx.Drop("cannot build the reply")
 		return
 	}
 
 	lease, ok := a.GetDHCPLease(m.ClientHWAddr.String())
+	if (!ok || lease.ClientIP == nil) && mt == dhcpv4.MessageTypeInform {
+		// guests with a statically configured address may still ask for options
+		lease.SubnetKey, _, ok = a.GetSubnetByIP(m.ClientIPAddr)
+		lease.ClientIP = m.ClientIPAddr
+	}
 	if !ok || lease.ClientIP == nil {
 		log.Warnf("(dhcpv4.dhcpHandler) NO LEASE FOUND: hwaddr=%s", m.ClientHWAddr.String())
+		tx.Drop("no lease found")
 		return
 	}
+	tx.IP, tx.Subnet, tx.VM = lease.ClientIP.String(), lease.SubnetKey, lease.VMKey
 
 	subnet, ok := a.GetSubnet(lease.SubnetKey)
 	if !ok {
 		log.Warnf("(dhcpv4.dhcpHandler) NO MATCHED SUBNET FOUND FOR LEASE: hwaddr=%s", m.ClientHWAddr.String())
+		tx.Drop("subnet not found")
+		return
+	}
+
+	// relayed request, the relay agent address must belong to the subnet of the lease
+	if relayed := !m.GatewayIPAddr.IsUnspecified(); relayed && (subnet.CIDR == nil || !subnet.CIDR.Contains(m.GatewayIPAddr)) {
+		log.Warnf("(dhcpv4.dhcpHandler) RELAY AGENT <%s> DOES NOT MATCH SUBNET <%s> OF LEASE: hwaddr=%s",
+			m.GatewayIPAddr.String(), lease.SubnetKey, m.ClientHWAddr.String())
+		tx.Drop("relay agent does not match the subnet")
+		return
+	}
+
+	// RFC 2131 4.3.4 and 4.3.3: DHCPRELEASE and DHCPDECLINE are not answered
+	switch mt {
+	case dhcpv4.MessageTypeRelease:
+		if a.handleRelease(m, lease) {
+			tx.Drop("release recorded, no reply")
+		} else {
+			tx.Drop("released address is not the lease address")
+		}
+		return
+	case dhcpv4.MessageTypeDecline:
+		a.handleDecline(m, lease)
+		tx.Drop("decline recorded, no reply")
 		return
 	}
 
-	log.Debugf("(dhcpv4.dhcpHandler) LEASE FOUND: hwaddr=%s, serverip=%s, clientip=%s, mask=%s, router=%+v, dns=%+v, ntp=%+v, leasetime=%d",
+	log.Debugf("(dhcpv4.dhcpHandler) LEASE FOUND: hwaddr=%s, serverip=%s, clientip=%s, mask=%s, router=%+v, dns=%+v, ntp=%+v, domain=%s, search=%+v, leasetime=%d",
 		m.ClientHWAddr.String(),
 		subnet.ServerIP.String(),
 		lease.ClientIP.String(),
@@ -315,6 +511,8 @@ func (a *DHCPAllocator) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv
 		subnet.Routers,
 		subnet.DNS,
 		subnet.NTP,
+		subnet.DomainName,
+		subnet.DomainSearch,
 		subnet.LeaseTime,
 	)
 
@@ -330,47 +528,255 @@ func (a *DHCPAllocator) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv
 	reply.UpdateOption(dhcpv4.OptSubnetMask(subnet.SubnetMask))
 	reply.UpdateOption(dhcpv4.OptRouter(subnet.Routers...))
 
-	if subnet.MTU > 0 && reply.IsOptionRequested(dhcpv4.OptionInterfaceMTU) {
-		reply.UpdateOption(dhcpv4.OptGeneric(
-			dhcpv4.OptionInterfaceMTU, dhcpv4.Uint16(subnet.MTU).ToBytes()))
+	reply.UpdateOption(dhcpv4.OptIPAddressLeaseTime(time.Duration(subnet.LeaseTime) * time.Second))
+	if subnet.RenewalTime > 0 {
+		reply.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionRenewTimeValue, Value: dhcpv4.Duration(time.Duration(subnet.RenewalTime) * time.Second)})
 	}
-	if len(subnet.DNS) > 0 {
-		reply.UpdateOption(dhcpv4.OptDNS(subnet.DNS...))
+	if subnet.RebindingTime > 0 {
+		reply.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionRebindingTimeValue, Value: dhcpv4.Duration(time.Duration(subnet.RebindingTime) * time.Second)})
 	}
 
-	//if pool.DomainName != "" {
-	//	reply.UpdateOption(dhcpv4.OptDomainName(pool.DomainName))
-	//}
-	//
-	//if len(pool.DomainSearch) > 0 {
-	//	dsl := rfc1035label.NewLabels()
-	//	dsl.Labels = append(dsl.Labels, pool.DomainSearch...)
-	//
-	//	reply.UpdateOption(dhcpv4.OptDomainSearch(dsl))
-	//}
-	//
-	if len(subnet.NTP) > 0 {
-		reply.UpdateOption(dhcpv4.OptNTPServers(subnet.NTP...))
+	chain := subnet.Chain
+	if chain == nil {
+		// subnet built without the options parser
+		chain, err = Plugins.Chain(subnet.Plugins)
+	}
+	if err != nil {
+		log.Errorf("(dhcpv4.dhcpHandler) invalid plugins of subnet <%s>: %v", lease.SubnetKey, err)
+		tx.Drop("invalid plugins")
+		return
+	}
+	if !dhcp.RunChain(chain, &PluginContext{Request: m, Reply: reply, Lease: lease, Subnet: subnet}) {
+		log.Debugf("(dhcpv4.dhcpHandler) reply to hwaddr [%s] dropped by the plugin chain", m.ClientHWAddr.String())
+		tx.Drop("dropped by the plugin chain")
+		return
 	}
 
-	reply.UpdateOption(dhcpv4.OptIPAddressLeaseTime(time.Duration(subnet.LeaseTime) * time.Second))
-
-	switch mt := m.MessageType(); mt {
+	switch mt {
 	case dhcpv4.MessageTypeDiscover:
 		log.Debugf("(dhcpv4.dhcpHandler) DHCPDISCOVER: %+v", m)
 		reply.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
 		log.Debugf("(dhcpv4.dhcpHandler) DHCPOFFER: %+v", reply)
 	case dhcpv4.MessageTypeRequest:
 		log.Debugf("(dhcpv4.dhcpHandler) DHCPREQUEST: %+v", m)
+		if serverID := m.ServerIdentifier(); serverID != nil && !serverID.Equal(subnet.ServerIP) {
+			// SELECTING state, the client has chosen the offer of another server
+			log.Debugf("(dhcpv4.dhcpHandler) DHCPREQUEST for server <%s> ignored: hwaddr=%s", serverID.String(), m.ClientHWAddr.String())
+			tx.Drop("request for another server")
+			return
+		}
+		if requestedIP := getRequestedIP(m); subnet.Authoritative && requestedIP != nil && !requestedIP.Equal(lease.ClientIP) {
+			// INIT-REBOOT, RENEWING or REBINDING state with an address that is not leased to the client
+			a.sendNak(conn, m, subnet, fmt.Sprintf("requested address %s is not leased to the client", requestedIP.String()))
+			tx.ReplyType = dhcpv4.MessageTypeNak.String()
+			return
+		}
+		reply.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+		a.setForceRenewNonce(conn, m, reply)
+		log.Debugf("(dhcpv4.dhcpHandler) DHCPACK: %+v", reply)
+	case dhcpv4.MessageTypeInform:
+		log.Debugf("(dhcpv4.dhcpHandler) DHCPINFORM: %+v", m)
+		// RFC 2131 4.3.5: no yiaddr and no lease time for an INFORM acknowledgement
+		reply.ClientIPAddr = m.ClientIPAddr
+		reply.YourIPAddr = net.IPv4zero
+		reply.DeleteOption(dhcpv4.OptionIPAddressLeaseTime)
+		reply.DeleteOption(dhcpv4.OptionRenewTimeValue)
+		reply.DeleteOption(dhcpv4.OptionRebindingTimeValue)
 		reply.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
 		log.Debugf("(dhcpv4.dhcpHandler) DHCPACK: %+v", reply)
 	default:
 		log.Warnf("(dhcpv4.dhcpHandler) Unhandled message type for hwaddr [%s]: %v", m.ClientHWAddr.String(), mt)
+		tx.Drop("unhandled message type")
 		return
 	}
 
-	if _, err := conn.WriteTo(reply.ToBytes(), peer); err != nil {
+	// the relay agent information option 82 is copied from the request by NewReplyFromRequest
+	if _, err := conn.WriteTo(reply.ToBytes(), replyAddr(m, peer)); err != nil {
 		log.Errorf("(dhcpv4.dhcpHandler) Cannot reply to client: %v", err)
+		tx.Drop("cannot send the reply")
+		return
+	}
+	tx.ReplyType = reply.MessageType().String()
+	a.updateLeaseStatus(m, time.Duration(subnet.LeaseTime)*time.Second)
+}
+
+// isIPXEClient iPXE identifies itself with the user class "iPXE"
+func isIPXEClient(m *dhcpv4.DHCPv4) bool {
+	return slices.Contains(m.UserClass(), "iPXE")
+}
+
+// isHTTPBootClient UEFI HTTP boot firmwares send the "HTTPClient" vendor class
+func isHTTPBootClient(m *dhcpv4.DHCPv4) bool {
+	return strings.HasPrefix(m.ClassIdentifier(), "HTTPClient")
+}
+
+// isNetBootClient PXE firmwares send the "PXEClient" vendor class and the client architecture option 93
+func isNetBootClient(m *dhcpv4.DHCPv4) bool {
+	return strings.HasPrefix(m.ClassIdentifier(), "PXEClient") || len(m.ClientArch()) > 0 ||
+		isIPXEClient(m) || isHTTPBootClient(m)
+}
+
+// setNetBootOptions Fill siaddr/sname/file and options 66/67 for both boot phases:
+// the firmware PXE gets the architecture specific loader, the chain-loaded iPXE gets its script
+func setNetBootOptions(m, reply *dhcpv4.DHCPv4, netBoot NetBoot) {
+	bootFile := netBoot.BootFile
+	for _, arch := range m.ClientArch() {
+		if file, ok := netBoot.ArchBootFiles[arch]; ok {
+			bootFile = file
+			break
+		}
+	}
+	if netBoot.IPXEBootFile != "" && isIPXEClient(m) {
+		bootFile = netBoot.IPXEBootFile
+	}
+	httpBoot := netBoot.HTTPBootURL != "" && isHTTPBootClient(m)
+	if httpBoot {
+		bootFile = netBoot.HTTPBootURL
+	}
+
+	if netBoot.NextServer != nil {
+		reply.ServerIPAddr = netBoot.NextServer
+	}
+	reply.ServerHostName = netBoot.TFTPServerName
+	reply.BootFileName = bootFile
+
+	if netBoot.TFTPServerName != "" && reply.IsOptionRequested(dhcpv4.OptionTFTPServerName) {
+		reply.UpdateOption(dhcpv4.OptTFTPServerName(netBoot.TFTPServerName))
+	}
+	if bootFile != "" && reply.IsOptionRequested(dhcpv4.OptionBootfileName) {
+		reply.UpdateOption(dhcpv4.OptBootFileName(bootFile))
+	}
+	if httpBoot {
+		// UEFI only accepts the url in the file field when the reply carries the "HTTPClient" vendor class
+		reply.UpdateOption(dhcpv4.OptClassIdentifier("HTTPClient"))
+	} else if strings.HasPrefix(m.ClassIdentifier(), "PXEClient") {
+		reply.UpdateOption(dhcpv4.OptClassIdentifier("PXEClient"))
+	}
+	log.Debugf("(dhcpv4.setNetBootOptions) hwaddr=%s, arch=%v, nextserver=%s, bootfile=%s",
+		m.ClientHWAddr.String(), m.ClientArch(), reply.ServerIPAddr.String(), bootFile)
+}
+
+// setHostnameOptions Send the virtual machine name as option 12,
+// and answer the client FQDN option 81 if the client sent it
+func setHostnameOptions(m, reply *dhcpv4.DHCPv4, lease DHCPLease, subnet OVNSubnet) {
+	hostname, fqdn, err := dhcp.RenderHostname(lease.VMKey, lease.SubnetKey, subnet.FQDNTemplate, subnet.DomainName)
+	if err != nil {
+		log.Warnf("(dhcpv4.setHostnameOptions) render FQDN of vm <%s> failed: %v", lease.VMKey, err)
+	}
+	if hostname != "" {
+		reply.UpdateOption(dhcpv4.OptHostName(hostname))
+	}
+	clientFQDN := m.GetOneOption(dhcpv4.OptionFQDN)
+	if len(clientFQDN) < 3 || fqdn == "" {
+		return
+	}
+	// RFC 4702 3.1: the server does not perform DNS updates, RCODE1 and RCODE2 are set to 255
+	flags := fqdnFlagN
+	if clientFQDN[0]&fqdnFlagS != 0 {
+		flags |= fqdnFlagO
+	}
+	value := []byte{0, 255, 255}
+	if clientFQDN[0]&fqdnFlagE != 0 {
+		flags |= fqdnFlagE
+		value = append(value, (&rfc1035label.Labels{Labels: []string{fqdn}}).ToBytes()...)
+	} else {
+		value = append(value, []byte(fqdn)...)
+	}
+	value[0] = flags
+	reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionFQDN, value))
+}
+
+// replyAddr RFC 2131 4.1: replies to relayed requests are sent to the server port of the relay agent
+func replyAddr(m *dhcpv4.DHCPv4, peer net.Addr) net.Addr {
+	if !m.GatewayIPAddr.IsUnspecified() {
+		return &net.UDPAddr{IP: m.GatewayIPAddr, Port: dhcpv4.ServerPort}
+	}
+	return peer
+}
+
+// getRequestedIP Returns the address requested in option 50 (SELECTING/INIT-REBOOT)
+// or ciaddr (RENEWING/REBINDING), nil if the client did not ask for a specific address
+func getRequestedIP(m *dhcpv4.DHCPv4) net.IP {
+	if ip := m.RequestedIPAddress(); ip != nil && !ip.IsUnspecified() {
+		return ip
+	}
+	if ip := m.ClientIPAddr; ip != nil && !ip.IsUnspecified() {
+		return ip
+	}
+	return nil
+}
+
+// sendNak RFC 2131 4.3.2: the DHCPNAK is broadcast, since the client may not own the requested address
+func (a *DHCPAllocator) sendNak(conn net.PacketConn, m *dhcpv4.DHCPv4, subnet OVNSubnet, reason string) {
+	nak, err := dhcpv4.NewReplyFromRequest(m,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeNak),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(subnet.ServerIP)),
+		dhcpv4.WithOption(dhcpv4.OptMessage(reason)),
+	)
+	if err != nil {
+		log.Errorf("(dhcpv4.sendNak) NewReplyFromRequest failed: %v", err)
+		return
+	}
+	nak.SetBroadcast()
+	log.Infof("(dhcpv4.sendNak) DHCPNAK to hwaddr [%s]: %s", m.ClientHWAddr.String(), reason)
+	var peer net.Addr = &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}
+	if !m.GatewayIPAddr.IsUnspecified() {
+		peer = replyAddr(m, peer)
+	}
+	if _, err := conn.WriteTo(nak.ToBytes(), peer); err != nil {
+		log.Errorf("(dhcpv4.sendNak) Cannot reply to client: %v", err)
+	}
+}
+
+// handleRelease The lease is a static reservation of the pod, so a DHCPRELEASE only needs to be recorded,
+// returns false if the released address is not the lease address
+func (a *DHCPAllocator) handleRelease(m *dhcpv4.DHCPv4, lease DHCPLease) bool {
+	log.Debugf("(dhcpv4.handleRelease) DHCPRELEASE: %+v", m)
+	if !m.ClientIPAddr.Equal(lease.ClientIP) {
+		log.Warnf("(dhcpv4.handleRelease) hwaddr [%s] released ip <%s> which is not its lease ip <%s>",
+			m.ClientHWAddr.String(), m.ClientIPAddr.String(), lease.ClientIP.String())
+		return false
+	}
+	log.Infof("(dhcpv4.handleRelease) hwaddr [%s] released ip <%s> of subnet <%s>",
+		m.ClientHWAddr.String(), lease.ClientIP.String(), lease.SubnetKey)
+	a.updateLeaseStatus(m, 0)
+	return true
+}
+
+// handleDecline A DHCPDECLINE means that the guest detected an address conflict on the leased ip,
+// which can not be resolved by the server, so the conflict is reported through events and metrics
+func (a *DHCPAllocator) handleDecline(m *dhcpv4.DHCPv4, lease DHCPLease) {
+	log.Debugf("(dhcpv4.handleDecline) DHCPDECLINE: %+v", m)
+	declinedIP := m.RequestedIPAddress()
+	if declinedIP == nil {
+		declinedIP = lease.ClientIP
+	}
+	hwAddr := m.ClientHWAddr.String()
+	log.Warnf("(dhcpv4.handleDecline) hwaddr [%s] declined ip <%s> of subnet <%s>: %s",
+		hwAddr, declinedIP.String(), lease.SubnetKey, m.Message())
+	a.updateLeaseStatus(m, 0)
+
+	if a.metrics != nil {
+		a.metrics.IncVMDHCPv4Decline(lease.VMKey, lease.SubnetKey, declinedIP.String(), hwAddr)
+	}
+	if a.recorder == nil {
+		return
+	}
+	podKeys, _ := a.GetMacPodKeys(hwAddr)
+	for _, podKey := range podKeys {
+		split := strings.Split(podKey, string(types.Separator))
+		if len(split) != 2 {
+			continue
+		}
+		ref := &corev1.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Namespace:  split[0],
+			Name:       split[1],
+		}
+		a.recorder.Event(ref, corev1.EventTypeWarning, "DHCPDecline",
+			fmt.Sprintf("Guest with hardware address <%s> declined DHCPv4 address <%s>, the address may be in conflict",
+				hwAddr, declinedIP.String()))
 	}
 }
 
@@ -403,7 +809,10 @@ func (a *DHCPAllocator) AddAndRun(nic string) error {
 	if log.StandardLogger().GetLevel() >= log.DebugLevel {
 		opt = server4.WithDebugLogger()
 	}
-	server, err := server4.NewServer(nic, &addr, a.dhcpHandler, opt)
+	handler := func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+		a.dhcpHandler(nic, conn, peer, m)
+	}
+	server, err := server4.NewServer(nic, &addr, handler, opt)
 	if err != nil {
 		return fmt.Errorf("error new DHCPv4 server on nic <%s>: %v", nic, err)
 	}
@@ -0,0 +1,254 @@
+package v4
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+	"tydic.io/dcloud-dhcp-controller/pkg/audit"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	"tydic.io/dcloud-dhcp-controller/pkg/metrics"
+)
+
+// packetConn records the replies written by the handler
+type packetConn struct {
+	net.PacketConn
+	replies []*dhcpv4.DHCPv4
+	peers   []net.Addr
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	reply, err := dhcpv4.FromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	c.replies = append(c.replies, reply)
+	c.peers = append(c.peers, addr)
+	return len(b), nil
+}
+
+var (
+	testHWAddr = net.HardwareAddr{0x52, 0x54, 0x00, 0xa1, 0xb2, 0xc3}
+	testPeer   = &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}
+)
+
+// newTestAllocator Returns an allocator leasing 10.0.0.12 of subnet1 to the pod default/pod1
+func newTestAllocator(t *testing.T, subnet OVNSubnet) (*DHCPAllocator, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	a := NewDHCPAllocator(context.TODO(), metrics.NewMetricsAllocator(), recorder)
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	subnet.ServerIP = net.ParseIP("10.0.0.1").To4()
+	subnet.CIDR = cidr
+	subnet.SubnetMask = cidr.Mask
+	subnet.LeaseTime = 3600
+	subnet.RenewalTime = 1800
+	subnet.RebindingTime = 3150
+	a.AddOrUpdateSubnet("subnet1", subnet)
+	lease := DHCPLease{ClientIP: net.ParseIP("10.0.0.12").To4(), SubnetKey: "subnet1", VMKey: "default/vm1"}
+	assert.NoError(t, a.AddPodDHCPLease(testHWAddr.String(), "default/pod1", lease))
+	return a, recorder
+}
+
+func newTestRequest(t *testing.T, messageType dhcpv4.MessageType, modifiers ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	m, err := dhcpv4.New(append([]dhcpv4.Modifier{
+		dhcpv4.WithHwAddr(testHWAddr),
+		dhcpv4.WithMessageType(messageType),
+	}, modifiers...)...)
+	assert.NoError(t, err)
+	return m
+}
+
+func Test_HandleDecline(t *testing.T) {
+	a, recorder := newTestAllocator(t, OVNSubnet{})
+	conn := &packetConn{}
+	m := newTestRequest(t, dhcpv4.MessageTypeDecline,
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("10.0.0.12"))))
+	a.dhcpHandler("net1", conn, testPeer, m)
+
+	// the server does not answer a DHCPDECLINE
+	assert.Empty(t, conn.replies)
+	lease, _ := a.GetDHCPLease(testHWAddr.String())
+	assert.Equal(t, dhcp.LeaseStateDeclined, lease.Status.State)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "DHCPDecline")
+	count, err := testutil.GatherAndCount(a.metrics, "dcloud_vm_dhcp_v4_decline_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func Test_HandleInform(t *testing.T) {
+	a, _ := newTestAllocator(t, OVNSubnet{})
+	conn := &packetConn{}
+	m := newTestRequest(t, dhcpv4.MessageTypeInform, dhcpv4.WithClientIP(net.ParseIP("10.0.0.12")))
+	a.dhcpHandler("net1", conn, testPeer, m)
+
+	assert.Len(t, conn.replies, 1)
+	reply := conn.replies[0]
+	assert.Equal(t, dhcpv4.MessageTypeAck, reply.MessageType())
+	assert.True(t, reply.YourIPAddr.IsUnspecified())
+	assert.True(t, reply.ClientIPAddr.Equal(net.ParseIP("10.0.0.12")))
+	assert.False(t, reply.Options.Has(dhcpv4.OptionIPAddressLeaseTime))
+	assert.False(t, reply.Options.Has(dhcpv4.OptionRenewTimeValue))
+	assert.False(t, reply.Options.Has(dhcpv4.OptionRebindingTimeValue))
+	assert.Equal(t, time.Duration(0), reply.IPAddressLeaseTime(0))
+}
+
+func Test_AuthoritativeNak(t *testing.T) {
+	foreignIP := dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("192.168.9.9")))
+	tests := []struct {
+		authoritative bool
+		modifiers     []dhcpv4.Modifier
+		want          dhcpv4.MessageType
+	}{
+		{
+			authoritative: true,
+			modifiers:     []dhcpv4.Modifier{foreignIP},
+			want:          dhcpv4.MessageTypeNak,
+		},
+		{
+			authoritative: true,
+			modifiers:     []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("10.0.0.12")))},
+			want:          dhcpv4.MessageTypeAck,
+		},
+		{
+			// RENEWING state, the address is in ciaddr
+			authoritative: true,
+			modifiers:     []dhcpv4.Modifier{dhcpv4.WithClientIP(net.ParseIP("10.0.0.13"))},
+			want:          dhcpv4.MessageTypeNak,
+		},
+		{
+			authoritative: false,
+			modifiers:     []dhcpv4.Modifier{foreignIP},
+			want:          dhcpv4.MessageTypeAck,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			a, _ := newTestAllocator(t, OVNSubnet{Authoritative: test.authoritative})
+			conn := &packetConn{}
+			a.dhcpHandler("net1", conn, testPeer, newTestRequest(t, dhcpv4.MessageTypeRequest, test.modifiers...))
+
+			assert.Len(t, conn.replies, 1)
+			reply := conn.replies[0]
+			assert.Equal(t, test.want, reply.MessageType())
+			if test.want == dhcpv4.MessageTypeNak {
+				assert.True(t, reply.IsBroadcast())
+				assert.True(t, reply.YourIPAddr.IsUnspecified())
+				assert.Equal(t, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}, conn.peers[0])
+			} else {
+				assert.True(t, reply.YourIPAddr.Equal(net.ParseIP("10.0.0.12")))
+			}
+		})
+	}
+}
+
+func Test_RelayedRequest(t *testing.T) {
+	relayInfo := dhcpv4.OptRelayAgentInfo(
+		dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("eth0")),
+		dhcpv4.OptGeneric(dhcpv4.AgentRemoteIDSubOption, []byte("leaf1")),
+	)
+	tests := []struct {
+		giaddr   string
+		wantPeer net.Addr
+	}{
+		{
+			giaddr:   "10.0.0.254",
+			wantPeer: &net.UDPAddr{IP: net.ParseIP("10.0.0.254"), Port: dhcpv4.ServerPort},
+		},
+		{
+			// the relay agent does not belong to the subnet of the lease
+			giaddr: "10.1.0.254",
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			a, _ := newTestAllocator(t, OVNSubnet{})
+			conn := &packetConn{}
+			m := newTestRequest(t, dhcpv4.MessageTypeDiscover,
+				dhcpv4.WithGatewayIP(net.ParseIP(test.giaddr)), dhcpv4.WithOption(relayInfo))
+			peer := &net.UDPAddr{IP: net.ParseIP(test.giaddr), Port: dhcpv4.ServerPort}
+			a.dhcpHandler("net1", conn, peer, m)
+
+			if test.wantPeer == nil {
+				assert.Empty(t, conn.replies)
+				return
+			}
+			assert.Len(t, conn.replies, 1)
+			reply := conn.replies[0]
+			assert.Equal(t, dhcpv4.MessageTypeOffer, reply.MessageType())
+			assert.Equal(t, test.wantPeer, conn.peers[0])
+			assert.True(t, reply.GatewayIPAddr.Equal(net.ParseIP(test.giaddr)))
+			// RFC 3046 2.2: the relay agent information is echoed in the reply
+			assert.Equal(t, relayInfo.Value.ToBytes(), reply.Options.Get(dhcpv4.OptionRelayAgentInformation))
+		})
+	}
+}
+
+func Test_RateLimitPlugin(t *testing.T) {
+	chain, err := Plugins.Chain([]string{"ratelimit", "dns"})
+	assert.NoError(t, err)
+	a, _ := newTestAllocator(t, OVNSubnet{
+		Plugins:     []string{"ratelimit", "dns"},
+		Chain:       chain,
+		RateLimiter: dhcp.NewRateLimiter(0.001, 2),
+	})
+	conn := &packetConn{}
+	for i := 0; i < 3; i++ {
+		a.dhcpHandler("net1", conn, testPeer, newTestRequest(t, dhcpv4.MessageTypeDiscover))
+	}
+
+	// the third request exceeds the burst of the client
+	assert.Len(t, conn.replies, 2)
+}
+
+func Test_ReleaseDeclineAudit(t *testing.T) {
+	tests := []struct {
+		messageType dhcpv4.MessageType
+		clientIP    string
+		wantReason  string
+	}{
+		{
+			messageType: dhcpv4.MessageTypeRelease,
+			clientIP:    "10.0.0.12",
+			wantReason:  "release recorded, no reply",
+		},
+		{
+			messageType: dhcpv4.MessageTypeRelease,
+			clientIP:    "10.0.0.13",
+			wantReason:  "released address is not the lease address",
+		},
+		{
+			messageType: dhcpv4.MessageTypeDecline,
+			wantReason:  "decline recorded, no reply",
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			a, _ := newTestAllocator(t, OVNSubnet{})
+			path := filepath.Join(t.TempDir(), "audit.log")
+			logger, err := audit.New(audit.Config{Sink: path})
+			assert.NoError(t, err)
+			a.SetAuditLogger(logger)
+			conn := &packetConn{}
+			a.dhcpHandler("net1", conn, testPeer, newTestRequest(t, test.messageType, dhcpv4.WithClientIP(net.ParseIP(test.clientIP))))
+			assert.NoError(t, logger.Close())
+
+			assert.Empty(t, conn.replies)
+			b, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			var tx audit.Transaction
+			assert.NoError(t, json.Unmarshal(b, &tx))
+			assert.Equal(t, test.messageType.String(), tx.MessageType)
+			assert.Equal(t, test.wantReason, tx.DropReason)
+		})
+	}
+}
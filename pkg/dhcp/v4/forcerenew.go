@@ -0,0 +1,106 @@
+package v4
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	log "github.com/sirupsen/logrus"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+const (
+	// MessageTypeForceRenew DHCPFORCERENEW (RFC 3203)
+	MessageTypeForceRenew = dhcpv4.MessageType(9)
+	// OptionForcerenewNonceCapable option 145 (RFC 6704), the algorithms supported by the client
+	OptionForcerenewNonceCapable = dhcpv4.GenericOptionCode(145)
+)
+
+// ErrForceRenewNotNegotiated the client did not ask for a forcerenew nonce, it would drop a DHCPFORCERENEW
+var ErrForceRenewNotNegotiated = errors.New("forcerenew nonce not negotiated")
+
+// forceRenewNonce the nonce sent to the client in the last DHCPACK
+// and the server connection that received its request
+type forceRenewNonce struct {
+	nonce []byte
+	conn  net.PacketConn
+}
+
+// isForceRenewNonceCapable The client supports the HMAC-MD5 forcerenew nonce authentication
+func isForceRenewNonceCapable(m *dhcpv4.DHCPv4) bool {
+	return slices.Contains(m.Options.Get(OptionForcerenewNonceCapable), dhcp.AuthAlgorithmHMACMD5)
+}
+
+// setForceRenewNonce RFC 6704 3.3: a new nonce is sent in the authentication option of each DHCPACK
+// to a nonce capable client, it is kept in memory only, the guest negotiates a new one on its next renewal
+func (a *DHCPAllocator) setForceRenewNonce(conn net.PacketConn, m, reply *dhcpv4.DHCPv4) {
+	if !isForceRenewNonceCapable(m) {
+		return
+	}
+	nonce, err := dhcp.NewReconfigureKey()
+	if err != nil {
+		log.Errorf("(dhcpv4.setForceRenewNonce) hwaddr [%s]: %v", m.ClientHWAddr.String(), err)
+		return
+	}
+	reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionAuthentication, dhcp.ReconfigureKeyAuth(nonce)))
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.nonces[m.ClientHWAddr.String()] = forceRenewNonce{nonce: nonce, conn: conn}
+}
+
+// ForceRenew Send a DHCPFORCERENEW to the guest holding the lease of hwAddr,
+// so that it renews the lease and picks up the changed options immediately
+func (a *DHCPAllocator) ForceRenew(hwAddr string) error {
+	a.mutex.RLock()
+	lease, hasLease := a.leases[hwAddr]
+	subnet, hasSubnet := a.subnets[lease.SubnetKey]
+	nonce, hasNonce := a.nonces[hwAddr]
+	a.mutex.RUnlock()
+
+	if !hasLease || lease.ClientIP == nil || !hasSubnet {
+		return fmt.Errorf("no lease found for hardware address <%s>", hwAddr)
+	}
+	if !hasNonce {
+		return ErrForceRenewNotNegotiated
+	}
+
+	msg, auth, err := newForceRenew(hwAddr, lease, subnet)
+	if err != nil {
+		return err
+	}
+	b := msg.ToBytes()
+	if err = dhcp.SignReconfigure(b, auth, nonce.nonce); err != nil {
+		return err
+	}
+
+	peer := &net.UDPAddr{IP: lease.ClientIP, Port: dhcpv4.ClientPort}
+	if _, err = nonce.conn.WriteTo(b, peer); err != nil {
+		return fmt.Errorf("cannot send DHCPFORCERENEW to <%s>: %v", peer.String(), err)
+	}
+	log.Infof("(dhcpv4.ForceRenew) DHCPFORCERENEW sent to hwaddr [%s] ip <%s>", hwAddr, lease.ClientIP.String())
+	return nil
+}
+
+// newForceRenew Returns the unsigned DHCPFORCERENEW and its authentication option value
+func newForceRenew(hwAddr string, lease DHCPLease, subnet OVNSubnet) (*dhcpv4.DHCPv4, []byte, error) {
+	mac, err := net.ParseMAC(hwAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth := dhcp.ReconfigureHMACAuth()
+	msg, err := dhcpv4.New(
+		dhcpv4.WithHwAddr(mac),
+		dhcpv4.WithMessageType(MessageTypeForceRenew),
+		dhcpv4.WithClientIP(lease.ClientIP),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(subnet.ServerIP)),
+		dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionAuthentication, auth)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg.OpCode = dhcpv4.OpcodeBootReply
+	return msg, auth, nil
+}
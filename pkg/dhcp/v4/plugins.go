@@ -0,0 +1,128 @@
+package v4
+
+import (
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	log "github.com/sirupsen/logrus"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// PluginContext the request, the reply being built and the lease of the client
+type PluginContext struct {
+	Request *dhcpv4.DHCPv4
+	Reply   *dhcpv4.DHCPv4
+	Lease   DHCPLease
+	Subnet  OVNSubnet
+}
+
+// Plugins the DHCPv4 reply pipeline, the subnet option plugins selects and orders them.
+// The server identifier, subnet mask, router and lease times are always set before the chain runs.
+var Plugins = &dhcp.Registry[*PluginContext]{}
+
+func init() {
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "mtu", Handler: mtuPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "dns", Handler: dnsPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "domain", Handler: domainPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "ntp", Handler: ntpPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "routes", Handler: routesPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "netboot", Handler: netBootPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "hostname", Handler: hostnamePlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "raw_options", Handler: rawOptionsPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "client_classes", Handler: clientClassesPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "ratelimit", Handler: rateLimitPlugin, Optional: true})
+}
+
+// rateLimitPlugin drop the requests of a client exceeding the rate_limit option, list it first to skip the other plugins
+func rateLimitPlugin(c *PluginContext) bool {
+	if c.Subnet.RateLimiter == nil || c.Subnet.RateLimiter.Allow(c.Request.ClientHWAddr.String()) {
+		return false
+	}
+	log.Debugf("(dhcpv4.rateLimitPlugin) hwaddr [%s] exceeded the rate limit", c.Request.ClientHWAddr.String())
+	return true
+}
+
+// mtuPlugin option 26
+func mtuPlugin(c *PluginContext) bool {
+	if c.Subnet.MTU > 0 && c.Reply.IsOptionRequested(dhcpv4.OptionInterfaceMTU) {
+		c.Reply.UpdateOption(dhcpv4.OptGeneric(
+			dhcpv4.OptionInterfaceMTU, dhcpv4.Uint16(c.Subnet.MTU).ToBytes()))
+	}
+	return false
+}
+
+// dnsPlugin option 6
+func dnsPlugin(c *PluginContext) bool {
+	if len(c.Subnet.DNS) > 0 {
+		c.Reply.UpdateOption(dhcpv4.OptDNS(c.Subnet.DNS...))
+	}
+	return false
+}
+
+// domainPlugin options 15 and 119
+func domainPlugin(c *PluginContext) bool {
+	if c.Subnet.DomainName != "" {
+		c.Reply.UpdateOption(dhcpv4.OptDomainName(c.Subnet.DomainName))
+	}
+
+	if len(c.Subnet.DomainSearch) > 0 {
+		dsl := rfc1035label.NewLabels()
+		dsl.Labels = append(dsl.Labels, c.Subnet.DomainSearch...)
+
+		c.Reply.UpdateOption(dhcpv4.OptDomainSearch(dsl))
+	}
+	return false
+}
+
+// ntpPlugin option 42
+func ntpPlugin(c *PluginContext) bool {
+	if len(c.Subnet.NTP) > 0 {
+		c.Reply.UpdateOption(dhcpv4.OptNTPServers(c.Subnet.NTP...))
+	}
+	return false
+}
+
+// routesPlugin options 121 and 249
+func routesPlugin(c *PluginContext) bool {
+	if len(c.Subnet.ClasslessStaticRoutes) > 0 {
+		c.Reply.UpdateOption(dhcpv4.OptClasslessStaticRoute(c.Subnet.ClasslessStaticRoutes...))
+		// older windows guests only understand the microsoft variant of option 121
+		if c.Reply.IsOptionRequested(OptionMSClasslessStaticRoute) {
+			c.Reply.UpdateOption(dhcpv4.OptGeneric(OptionMSClasslessStaticRoute,
+				dhcpv4.Routes(c.Subnet.ClasslessStaticRoutes).ToBytes()))
+		}
+	}
+	return false
+}
+
+// netBootPlugin PXE, iPXE and UEFI HTTP boot
+func netBootPlugin(c *PluginContext) bool {
+	if c.Subnet.NetBoot.Enabled() && isNetBootClient(c.Request) {
+		setNetBootOptions(c.Request, c.Reply, c.Subnet.NetBoot)
+	}
+	return false
+}
+
+// hostnamePlugin options 12 and 81
+func hostnamePlugin(c *PluginContext) bool {
+	if c.Subnet.Hostname && c.Lease.VMKey != "" {
+		setHostnameOptions(c.Request, c.Reply, c.Lease, c.Subnet)
+	}
+	return false
+}
+
+// rawOptionsPlugin option_<code> options of the subnet
+func rawOptionsPlugin(c *PluginContext) bool {
+	for _, option := range c.Subnet.RawOptions {
+		c.Reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(option.Code), option.Value))
+	}
+	return false
+}
+
+// clientClassesPlugin options of the first client class matched by the client
+func clientClassesPlugin(c *PluginContext) bool {
+	if class, ok := c.Subnet.MatchClientClass(c.Request); ok {
+		log.Debugf("(dhcpv4.clientClassesPlugin) hwaddr [%s] matches client class <%s>", c.Request.ClientHWAddr.String(), class.Name)
+		setClientClassOptions(c.Reply, class)
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package v4
+
+import (
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// SetLeaseNotify Notify the pod controller after the state of a lease changed
+func (a *DHCPAllocator) SetLeaseNotify(notify dhcp.LeaseNotify) {
+	a.mutex.Lock()
+	a.notify = notify
+	a.mutex.Unlock()
+}
+
+// updateLeaseStatus Record a transaction of the client in the status of its lease,
+// leaseTime is the lease time acknowledged to the client
+func (a *DHCPAllocator) updateLeaseStatus(m *dhcpv4.DHCPv4, leaseTime time.Duration) {
+	now := time.Now()
+	hwAddr := m.ClientHWAddr.String()
+	a.mutex.Lock()
+	lease, ok := a.leases[hwAddr]
+	if !ok {
+		a.mutex.Unlock()
+		return
+	}
+	previous := lease.Status
+	switch m.MessageType() {
+	case dhcpv4.MessageTypeDiscover:
+		lease.Status.Offer(now)
+	case dhcpv4.MessageTypeRequest:
+		lease.Status.Bind(now, leaseTime)
+	case dhcpv4.MessageTypeRelease:
+		lease.Status.Release(dhcp.LeaseStateReleased)
+	case dhcpv4.MessageTypeDecline:
+		lease.Status.Release(dhcp.LeaseStateDeclined)
+	default:
+		a.mutex.Unlock()
+		return
+	}
+	lease.Status.SetClient(m.HostName(), m.ClassIdentifier())
+	a.leases[hwAddr] = lease
+	changed := lease.Status.StateChanged(previous, now)
+	notify, podKeys := a.notify, a.macPodKeys[hwAddr].List()
+	a.mutex.Unlock()
+
+	if changed && lease.Status.State.Persistent() {
+		a.persistLeases(hwAddr)
+	}
+	// the DHCPLease keeps the state, a renewal only moves the expiry time
+	if notify == nil || !changed {
+		return
+	}
+	for _, podKey := range podKeys {
+		notify.NotifyLease(podKey)
+	}
+}
@@ -0,0 +1,113 @@
+package v4
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// SetLeaseStore Restore the persisted leases and persist the lease changes from now on,
+// must be called before the pod controller starts
+func (a *DHCPAllocator) SetLeaseStore(store dhcp.LeaseStore) error {
+	leases, err := store.List()
+	if err != nil {
+		return fmt.Errorf("cannot list the persisted leases: %v", err)
+	}
+	for _, stored := range leases {
+		if _, err := net.ParseMAC(stored.HWAddr); err != nil || stored.ClientIP.To4() == nil {
+			log.Warnf("(dhcpv4.SetLeaseStore) Invalid persisted lease %+v, skip it", stored)
+			continue
+		}
+		lease := DHCPLease{
+			ClientIP:  stored.ClientIP,
+			SubnetKey: stored.SubnetKey,
+			VMKey:     stored.VMKey,
+		}
+		for _, podKey := range stored.PodKeys {
+			if err := a.addPodDHCPLease(stored.HWAddr, podKey, lease); err != nil {
+				log.Warnf("(dhcpv4.SetLeaseStore) Cannot restore lease of hardware address <%s>: %v", stored.HWAddr, err)
+			}
+		}
+		if stored.Status != nil {
+			a.restoreLeaseStatus(stored.HWAddr, lease.ClientIP, *stored.Status)
+		}
+	}
+
+	writer := dhcp.NewLeaseWriter(store, a.storedLease)
+	go writer.Run(a.ctx)
+	a.mutex.Lock()
+	a.writer = writer
+	a.mutex.Unlock()
+
+	log.Infof("(dhcpv4.SetLeaseStore) %d leases restored", len(leases))
+	return nil
+}
+
+// ListPodKeys Returns the keys of all pods holding a lease, including the restored ones
+func (a *DHCPAllocator) ListPodKeys() []string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	podKeys := make([]string, 0, len(a.podkeyMACs))
+	for podKey := range a.podkeyMACs {
+		podKeys = append(podKeys, podKey)
+	}
+	return podKeys
+}
+
+// persistLeases Schedule the write of the current lease of the hardware addresses, or its deletion
+// if no pod holds it anymore. A failed write is retried, the in-memory lease is authoritative.
+func (a *DHCPAllocator) persistLeases(hwAddrs ...string) {
+	a.mutex.RLock()
+	writer := a.writer
+	a.mutex.RUnlock()
+
+	if writer != nil {
+		writer.Enqueue(hwAddrs...)
+	}
+}
+
+// storedLease Returns the lease of the hardware address as persisted, false if no pod holds it
+func (a *DHCPAllocator) storedLease(hwAddr string) (dhcp.StoredLease, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	lease, ok := a.leases[hwAddr]
+	if !ok {
+		return dhcp.StoredLease{}, false
+	}
+	return dhcp.StoredLease{
+		HWAddr:    hwAddr,
+		PodKeys:   a.macPodKeys[hwAddr].List(),
+		ClientIP:  lease.ClientIP,
+		SubnetKey: lease.SubnetKey,
+		VMKey:     lease.VMKey,
+		Status:    &lease.Status,
+	}, true
+}
+
+// restoreLeaseStatus Set the status of the lease of the hardware address if the guest has not sent any request
+// since the lease was added, returns false if the status was kept
+func (a *DHCPAllocator) restoreLeaseStatus(hwAddr string, clientIP net.IP, status dhcp.LeaseStatus) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	lease, ok := a.leases[hwAddr]
+	if !ok || !lease.ClientIP.Equal(clientIP) || !lease.Status.Initial() {
+		return false
+	}
+	lease.Status = status
+	a.leases[hwAddr] = lease
+	return true
+}
+
+// RestoreLeaseStatus Restore the status of a lease from its DHCPLease resource, example: a new leader
+// without lease store, the status is kept if the guest has sent a request since the lease was added
+func (a *DHCPAllocator) RestoreLeaseStatus(hwAddr string, clientIP net.IP, status dhcp.LeaseStatus) bool {
+	if !a.restoreLeaseStatus(hwAddr, clientIP, status) {
+		return false
+	}
+	a.persistLeases(hwAddr)
+	return true
+}
@@ -0,0 +1,54 @@
+package v4
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	"tydic.io/dcloud-dhcp-controller/pkg/metrics"
+)
+
+func Test_SetLeaseStore(t *testing.T) {
+	db, err := dhcp.OpenBoltDB(filepath.Join(t.TempDir(), "leases.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	store, err := dhcp.NewBoltLeaseStore(db, "v4")
+	assert.NoError(t, err)
+
+	boundTime := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	status := dhcp.LeaseStatus{
+		State:           dhcp.LeaseStateBound,
+		FirstOfferTime:  boundTime,
+		BoundTime:       boundTime,
+		ExpiryTime:      boundTime.Add(time.Hour),
+		LastRequestTime: boundTime,
+		Hostname:        "vm1",
+	}
+	assert.NoError(t, store.Save(dhcp.StoredLease{
+		HWAddr:    testHWAddr.String(),
+		PodKeys:   []string{"default/pod1"},
+		ClientIP:  net.ParseIP("10.0.0.12").To4(),
+		SubnetKey: "subnet1",
+		VMKey:     "default/vm1",
+		Status:    &status,
+	}))
+
+	// the status survives a failover
+	a := NewDHCPAllocator(context.TODO(), metrics.NewMetricsAllocator(), nil)
+	assert.NoError(t, a.SetLeaseStore(store))
+	lease, ok := a.GetDHCPLease(testHWAddr.String())
+	assert.True(t, ok)
+	assert.Equal(t, status, lease.Status)
+	stored, ok := a.storedLease(testHWAddr.String())
+	assert.True(t, ok)
+	assert.Equal(t, &status, stored.Status)
+
+	// a status restored from the DHCPLease does not override a newer transaction
+	assert.False(t, a.RestoreLeaseStatus(testHWAddr.String(), net.ParseIP("10.0.0.12"), dhcp.LeaseStatus{State: dhcp.LeaseStateReleased}))
+	lease, _ = a.GetDHCPLease(testHWAddr.String())
+	assert.Equal(t, dhcp.LeaseStateBound, lease.Status.State)
+}
@@ -0,0 +1,100 @@
+package v6
+
+import (
+	"encoding/hex"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	log "github.com/sirupsen/logrus"
+)
+
+// leaseCandidate hardware address of the client, learn indicates that
+// it was not derived from the DUID and should be bound to it
+type leaseCandidate struct {
+	hwaddr net.HardwareAddr
+	learn  bool
+}
+
+// lookupLease Find the lease of the client, the hardware address is taken in order from:
+//  1. the relay client link-layer address option (RFC 6939) or the EUI-64 peer address of the relay
+//  2. the EUI-64 link-local source address of the client
+//  3. the binding learned from 1 or 2 on first contact, for DUID-UUID and DUID-EN clients
+//  4. the link-layer address of a DUID-LL or DUID-LLT
+//
+// The first hardware address with a lease wins.
+func (a *DHCPAllocator) lookupLease(peer net.Addr, m dhcpv6.DHCPv6, msg *dhcpv6.Message) (net.HardwareAddr, DHCPLease, bool) {
+	duid := msg.Options.ClientID()
+
+	var candidates []leaseCandidate
+	if m.IsRelay() {
+		if inner, err := dhcpv6.DecapsulateRelayIndex(m, -1); err == nil {
+			relay := inner.(*dhcpv6.RelayMessage)
+			if _, hwaddr := relay.Options.ClientLinkLayerAddress(); hwaddr != nil {
+				candidates = append(candidates, leaseCandidate{hwaddr: hwaddr, learn: true})
+			}
+			if hwaddr, err := dhcpv6.GetMacAddressFromEUI64(relay.PeerAddr); err == nil {
+				candidates = append(candidates, leaseCandidate{hwaddr: hwaddr, learn: true})
+			}
+		}
+	} else if udpAddr, ok := peer.(*net.UDPAddr); ok && udpAddr.IP.IsLinkLocalUnicast() {
+		if hwaddr, err := dhcpv6.GetMacAddressFromEUI64(udpAddr.IP); err == nil {
+			candidates = append(candidates, leaseCandidate{hwaddr: hwaddr, learn: true})
+		}
+	}
+
+	var duidKey string
+	if duid != nil {
+		duidKey = hex.EncodeToString(duid.ToBytes())
+		if hwaddr, ok := a.getDUIDBinding(duidKey); ok {
+			candidates = append(candidates, leaseCandidate{hwaddr: hwaddr})
+		}
+		switch d := duid.(type) {
+		case *dhcpv6.DUIDLL:
+			candidates = append(candidates, leaseCandidate{hwaddr: d.LinkLayerAddr})
+		case *dhcpv6.DUIDLLT:
+			candidates = append(candidates, leaseCandidate{hwaddr: d.LinkLayerAddr})
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate.hwaddr == nil {
+			continue
+		}
+		lease, ok := a.GetDHCPLease(candidate.hwaddr.String())
+		if !ok || lease.ClientIP == nil {
+			continue
+		}
+		if candidate.learn && duidKey != "" {
+			a.bindDUID(duidKey, candidate.hwaddr.String())
+		}
+		return candidate.hwaddr, lease, true
+	}
+
+	if len(candidates) > 0 {
+		return candidates[0].hwaddr, DHCPLease{}, false
+	}
+	return nil, DHCPLease{}, false
+}
+
+func (a *DHCPAllocator) getDUIDBinding(duidKey string) (net.HardwareAddr, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	macAddr, ok := a.duidMACs[duidKey]
+	if !ok {
+		return nil, false
+	}
+	hwaddr, err := net.ParseMAC(macAddr)
+	return hwaddr, err == nil
+}
+
+func (a *DHCPAllocator) bindDUID(duidKey, macAddr string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.duidMACs[duidKey] == macAddr {
+		return
+	}
+	a.duidMACs[duidKey] = macAddr
+	log.Debugf("(dhcpv6.bindDUID) client DUID <%s> bound to hardware address <%s>", duidKey, macAddr)
+}
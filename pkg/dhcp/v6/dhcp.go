@@ -6,29 +6,97 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/insomniacslk/dhcp/dhcpv6/server6"
 	"github.com/insomniacslk/dhcp/iana"
+	"github.com/insomniacslk/dhcp/rfc1035label"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"tydic.io/dcloud-dhcp-controller/pkg/audit"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
 )
 
 type OVNSubnet struct {
-	ServerMac string   // dhcp server mac
-	ServerIP  net.IP   // dhcp server ip
-	NTP       []net.IP // ipv6 ntp地址
-	DNS       []net.IP // ipv6 dns地址
-	LeaseTime int      // dhcp lease time (second), default: 3600
+	ServerMac string     // dhcp server mac
+	ServerIP  net.IP     // dhcp server ip
+	CIDR      *net.IPNet // ipv6 cidr of the subnet, used to validate relayed requests
+	// ServerDUID stable server identifier, default: DUID-LL of the server mac
+	ServerDUID dhcpv6.DUID
+	NTP        []net.IP // ipv6 ntp地址
+	NTPFQDN    []string // ntp域名, sent as NTP FQDN suboptions (RFC 5908)
+	DNS        []net.IP // ipv6 dns地址
+	LeaseTime  int      // dhcp lease time (second), default: 3600
+	// PreferredLifetime preferred lifetime of the addresses and prefixes (second), default: valid lifetime
+	PreferredLifetime int
+	// ValidLifetime valid lifetime of the addresses and prefixes (second), default: lease time
+	ValidLifetime int
+	// RenewalTime T1 of IA_NA and IA_PD (second), default: 0, the client chooses it
+	RenewalTime int
+	// RebindingTime T2 of IA_NA and IA_PD (second), default: 0, the client chooses it
+	RebindingTime int
+	// Hostname answer the client FQDN option 39 with the virtual machine FQDN
+	Hostname bool
+	// FQDNTemplate template of the client FQDN, default: <hostname>
+	FQDNTemplate string
+	// BootFileURL option 59 for network boot, example: http://[2001:db8::10]/boot.efi
+	BootFileURL string
+	// BootFileParams option 60 parameters of the boot file
+	BootFileParams []string
+	// DelegatedPrefixPool pool of the prefixes delegated to the virtual machines by IA_PD
+	DelegatedPrefixPool *net.IPNet
+	// DelegatedPrefixLen length of each delegated prefix, default: 64
+	DelegatedPrefixLen int
+	// Interface provider interface of the DHCP server serving the subnet
+	Interface string
+	// MTU advertised by router advertisements, default: subnet mtu
+	MTU uint32
+	// DomainSearch domain search list advertised by router advertisements (DNSSL)
+	DomainSearch []string
+	// RA router advertisement settings
+	RA RouterAdvertisement
+	// Stateless only answer Information-Request, the addresses are configured by SLAAC
+	Stateless bool
+	// RawOptions option_<code> options sent verbatim, they override the options above
+	RawOptions []dhcp.RawOption
+	// Plugins names of the reply plugins, nil means the default chain, see Plugins
+	Plugins []string
+	// Chain the reply plugins selected by Plugins, built once with the subnet
+	Chain []dhcp.Plugin[*PluginContext]
+	// RateLimit requests per second accepted from each client by the ratelimit plugin
+	RateLimit float64
+	// RateLimitBurst requests accepted at once from each client by the ratelimit plugin
+	RateLimitBurst int
+	// RateLimiter token buckets of the ratelimit plugin, nil if the subnet has no rate limit
+	RateLimiter *dhcp.RateLimiter
+}
+
+// Equal Reports whether the subnets have the same options, the built chain and the rate limiter state are not compared
+func (s OVNSubnet) Equal(o OVNSubnet) bool {
+	s.Chain, o.Chain = nil, nil
+	s.RateLimiter, o.RateLimiter = nil, nil
+	return reflect.DeepEqual(s, o)
 }
 
 type DHCPLease struct {
 	ClientIP  net.IP
 	SubnetKey string
+	VMKey     string     // namespace/name of the virtual machine holding the lease
+	Prefix    *net.IPNet // prefix delegated to the virtual machine by IA_PD, nil if none
+	Status    dhcp.LeaseStatus
 }
 
+// RFC 4704 client FQDN option flags
+const (
+	fqdnFlagS uint8 = 1 << iota // server should perform the AAAA RR update
+	fqdnFlagO                   // server has overridden the client S bit
+	fqdnFlagN                   // server should not perform any DNS update
+)
+
 type DHCPServer struct {
 	server     *server6.Server
 	cancelFunc context.CancelFunc
@@ -46,7 +114,15 @@ type DHCPAllocator struct {
 	subnetPodKeys map[string]sets.String // SubnetKey -> PodKeys    mapping
 	podkeySubnets map[string]sets.String // PodKey    -> SubnetKeys mapping
 
+	// Client DUID learned on first contact, for DUID types without a link-layer address
+	duidMACs map[string]string // DUID      -> Mac mapping
+	// Reconfigure keys of the clients that accept Reconfigure messages
+	reconfigureKeys map[string]reconfigureKey // Mac -> reconfigure key
+
 	servers map[string]DHCPServer
+	notify  dhcp.LeaseNotify
+	audit   *audit.Logger
+	writer  *dhcp.LeaseWriter // nil keeps the leases in memory only
 	mutex   sync.RWMutex
 }
 
@@ -61,17 +137,20 @@ func NewDHCPAllocator(ctx context.Context) *DHCPAllocator {
 	podkeyMACs := make(map[string]sets.String)
 	subnetPodKeys := make(map[string]sets.String)
 	podkeySubnets := make(map[string]sets.String)
+	duidMACs := make(map[string]string)
 	servers := make(map[string]DHCPServer)
 
 	return &DHCPAllocator{
-		ctx:           ctx,
-		subnets:       subnets,
-		leases:        leases,
-		macPodKeys:    macPodKeys,
-		podkeyMACs:    podkeyMACs,
-		subnetPodKeys: subnetPodKeys,
-		podkeySubnets: podkeySubnets,
-		servers:       servers,
+		ctx:             ctx,
+		subnets:         subnets,
+		leases:          leases,
+		macPodKeys:      macPodKeys,
+		podkeyMACs:      podkeyMACs,
+		subnetPodKeys:   subnetPodKeys,
+		podkeySubnets:   podkeySubnets,
+		duidMACs:        duidMACs,
+		reconfigureKeys: make(map[string]reconfigureKey),
+		servers:         servers,
 	}
 }
 
@@ -82,11 +161,51 @@ func (a *DHCPAllocator) GetSubnet(name string) (OVNSubnet, bool) {
 	return subnet, ok
 }
 
+// GetSubnetByIP Returns the subnet whose cidr contains the ip
+func (a *DHCPAllocator) GetSubnetByIP(ip net.IP) (string, OVNSubnet, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if ip == nil || ip.IsUnspecified() {
+		return "", OVNSubnet{}, false
+	}
+	for subnetKey, subnet := range a.subnets {
+		if subnet.CIDR != nil && subnet.CIDR.Contains(ip) {
+			return subnetKey, subnet, true
+		}
+	}
+	return "", OVNSubnet{}, false
+}
+
+// GetSubnetByInterface Returns the subnet served on the nic, a stateless subnet is preferred if the nic serves several
+func (a *DHCPAllocator) GetSubnetByInterface(nic string) (string, OVNSubnet, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	var found string
+	for subnetKey, subnet := range a.subnets {
+		if subnet.Interface != nic {
+			continue
+		}
+		if found == "" || subnet.Stateless && !a.subnets[found].Stateless ||
+			subnet.Stateless == a.subnets[found].Stateless && subnetKey < found {
+			found = subnetKey
+		}
+	}
+	if found == "" {
+		return "", OVNSubnet{}, false
+	}
+	return found, a.subnets[found], true
+}
+
 func (a *DHCPAllocator) AddOrUpdateSubnet(subnetKey string, subnet OVNSubnet) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	_, ok := a.subnets[subnetKey]
+	old, ok := a.subnets[subnetKey]
+	if ok && old.RateLimiter != nil && subnet.RateLimiter != nil &&
+		old.RateLimit == subnet.RateLimit && old.RateLimitBurst == subnet.RateLimitBurst {
+		// keep the token buckets of the clients on resync
+		subnet.RateLimiter = old.RateLimiter
+	}
 	a.subnets[subnetKey] = subnet
 
 	if ok {
@@ -147,10 +266,23 @@ func (a *DHCPAllocator) HasPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLea
 	if !existLease {
 		return false
 	}
+	// the runtime status is not part of the pod lease
+	lease.Status = dhcpLease.Status
 	return reflect.DeepEqual(lease, dhcpLease)
 }
 
 func (a *DHCPAllocator) AddPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLease) error {
+	if a.HasPodDHCPLease(hwAddr, podKey, dhcpLease) {
+		return nil
+	}
+	if err := a.addPodDHCPLease(hwAddr, podKey, dhcpLease); err != nil {
+		return err
+	}
+	a.persistLeases(hwAddr)
+	return nil
+}
+
+func (a *DHCPAllocator) addPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLease) error {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
@@ -171,6 +303,18 @@ func (a *DHCPAllocator) AddPodDHCPLease(hwAddr, podKey string, dhcpLease DHCPLea
 		return fmt.Errorf("hwaddr <%s> is not valid", hwAddr)
 	}
 
+	if dhcpLease.Prefix != nil {
+		if macAddr, prefix, ok := a.overlappingPrefix(hwAddr, dhcpLease.Prefix); ok {
+			return fmt.Errorf("%w: prefix <%s> overlaps prefix <%s> of hardware address <%s>",
+				ErrPrefixOverlap, dhcpLease.Prefix.String(), prefix.String(), macAddr)
+		}
+	}
+
+	if lease, ok := a.leases[hwAddr]; ok && lease.ClientIP.Equal(dhcpLease.ClientIP) {
+		dhcpLease.Status = lease.Status
+	} else {
+		dhcpLease.Status = dhcp.LeaseStatus{State: dhcp.LeaseStateAllocated}
+	}
 	a.leases[hwAddr] = dhcpLease
 
 	// add mac to podKeys mapping
@@ -214,6 +358,16 @@ func (a *DHCPAllocator) GetPodMacAddress(podKey string) ([]string, bool) {
 	return nil, ok
 }
 
+func (a *DHCPAllocator) GetMacPodKeys(hwAddr string) ([]string, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	keySet, ok := a.macPodKeys[hwAddr]
+	if ok {
+		return keySet.List(), ok
+	}
+	return nil, ok
+}
+
 func (a *DHCPAllocator) GetPodKeys(subnetKey string) ([]string, bool) {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
@@ -225,6 +379,15 @@ func (a *DHCPAllocator) GetPodKeys(subnetKey string) ([]string, bool) {
 }
 
 func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
+	hwAddrs, _ := a.GetPodMacAddress(podKey)
+	if err := a.deletePodDHCPLease(podKey); err != nil {
+		return err
+	}
+	a.persistLeases(hwAddrs...)
+	return nil
+}
+
+func (a *DHCPAllocator) deletePodDHCPLease(podKey string) error {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
@@ -250,6 +413,7 @@ func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
 		if ok && keySet.Equal(sets.NewString(podKey)) {
 			delete(a.leases, macAddr)
 			delete(a.macPodKeys, macAddr)
+			delete(a.reconfigureKeys, macAddr)
 			delMacList = append(delMacList, macAddr)
 		} else if ok {
 			a.macPodKeys[macAddr] = keySet.Delete(podKey)
@@ -258,6 +422,12 @@ func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
 	delete(a.podkeyMACs, podKey)
 	log.Debugf("(dhcpv6.DeletePodDHCPLease) Pod <%s> lease deleted for hardware address: %+v", podKey, delMacList)
 
+	for duid, macAddr := range a.duidMACs {
+		if slices.Contains(delMacList, macAddr) {
+			delete(a.duidMACs, duid)
+		}
+	}
+
 	for _, subnetKey := range subnets.List() {
 		keySet, ok := a.subnetPodKeys[subnetKey]
 		if ok && keySet.Equal(sets.NewString(podKey)) {
@@ -273,10 +443,13 @@ func (a *DHCPAllocator) DeletePodDHCPLease(podKey string) error {
 	return nil
 }
 
-func (a *DHCPAllocator) dhcpHandler(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6) {
+func (a *DHCPAllocator) dhcpHandler(nic string, conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6) {
+	tx := a.beginAudit(nic)
+	defer tx.End()
 
 	if m == nil {
 		log.Errorf("(dhcpv6.dhcpHandler) packet is nil!")
+		tx.Drop("empty packet")
 		return
 	}
 
@@ -285,69 +458,97 @@ func (a *DHCPAllocator) dhcpHandler(conn net.PacketConn, peer net.Addr, m dhcpv6
 	msg, err := m.GetInnerMessage()
 	if err != nil {
 		log.Errorf("(dhcpv6.dhcpHandler) failed loading inner message: %s", err)
+		tx.Drop("cannot read the inner message")
 		return
 	}
+	tx.XID, tx.MessageType = msg.TransactionID.String(), msg.MessageType.String()
 
-	hwaddr, err := dhcpv6.ExtractMAC(m)
-	if err != nil {
-		log.Errorf("(dhcpv6.dhcpHandler) error extracting hwaddr: %s", err)
-		return
+	hwaddr, lease, ok := a.lookupLease(peer, m, msg)
+	if hwaddr != nil {
+		tx.MAC = hwaddr.String()
 	}
-
-	lease, ok := a.GetDHCPLease(hwaddr.String())
-	if !ok || lease.ClientIP == nil {
-		log.Warnf("(dhcpv6.dhcpHandler) NO LEASE FOUND: hwaddr=%s", hwaddr.String())
+	if !ok && msg.MessageType == dhcpv6.MessageTypeInformationRequest {
+		// stateless clients without a lease are matched by their address or the relay link address,
+		// clients on the link usually send from their link-local address and are matched by the receiving nic
+		if lease.SubnetKey, _, ok = a.GetSubnetByIP(getClientAddr(peer, m)); !ok && !m.IsRelay() {
+			lease.SubnetKey, _, ok = a.GetSubnetByInterface(nic)
+		}
+	}
+	if !ok {
+		log.Warnf("(dhcpv6.dhcpHandler) NO LEASE FOUND: hwaddr=%s, duid=%s", hwaddr, msg.Options.ClientID())
+		tx.Drop("no lease found")
 		return
 	}
+	tx.Subnet, tx.VM = lease.SubnetKey, lease.VMKey
+	if lease.ClientIP != nil {
+		tx.IP = lease.ClientIP.String()
+	}
 
 	subnet, ok := a.GetSubnet(lease.SubnetKey)
 	if !ok {
-		log.Warnf("(dhcpv6.dhcpHandler) NO MATCHED SUBNET FOUND FOR LEASE: hwaddr=%s", hwaddr.String())
+		log.Warnf("(dhcpv6.dhcpHandler) NO MATCHED SUBNET FOUND FOR LEASE: hwaddr=%s", hwaddr)
+		tx.Drop("subnet not found")
+		return
+	}
+
+	if subnet.Stateless && msg.MessageType != dhcpv6.MessageTypeInformationRequest {
+		log.Debugf("(dhcpv6.dhcpHandler) STATELESS SUBNET <%s> IGNORES %s: hwaddr=%s", lease.SubnetKey, msg.MessageType, hwaddr)
+		tx.Drop("stateless subnet")
+		return
+	}
+
+	// relayed request, the link address of the relay agent closest to the client must belong to the subnet of the lease
+	if linkAddr := getRelayLinkAddr(m); linkAddr != nil && (subnet.CIDR == nil || !subnet.CIDR.Contains(linkAddr)) {
+		log.Warnf("(dhcpv6.dhcpHandler) RELAY LINK ADDRESS <%s> DOES NOT MATCH SUBNET <%s> OF LEASE: hwaddr=%s",
+			linkAddr.String(), lease.SubnetKey, hwaddr)
+		tx.Drop("relay link address does not match the subnet")
 		return
 	}
 
 	log.Debugf("(dhcpv6.dhcpHandler) LEASE FOUND: hwaddr=%s, serverip=%s, serverid=%s, clientip=%s, ntp=%+v, dns=%+v, leasetime=%d",
-		hwaddr.String(),
+		hwaddr,
 		subnet.ServerIP.String(),
 		subnet.ServerMac,
-		lease.ClientIP.String(),
+		lease.ClientIP,
 		subnet.NTP,
 		subnet.DNS,
 		subnet.LeaseTime,
 	)
-	serverMac, _ := net.ParseMAC(subnet.ServerMac)
-
-	modifiers := []dhcpv6.Modifier{
-		dhcpv6.WithIANA(dhcpv6.OptIAAddress{ // set ip lease
-			IPv6Addr:          lease.ClientIP,
-			PreferredLifetime: time.Duration(subnet.LeaseTime) * time.Second,
-			ValidLifetime:     time.Duration(subnet.LeaseTime) * time.Second,
-		}),
-		dhcpv6.WithServerID(&dhcpv6.DUIDLLT{ // set server mac
-			HWType:        iana.HWTypeEthernet,
-			Time:          dhcpv6.GetTime(),
-			LinkLayerAddr: serverMac,
-		}),
+	serverID := serverDUID(subnet)
+	switch msg.MessageType { //nolint:exhaustive
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRelease, dhcpv6.MessageTypeDecline:
+		// messages addressed to another server must be discarded
+		if sid := msg.Options.ServerID(); sid == nil || !sid.Equal(serverID) {
+			log.Debugf("(dhcpv6.dhcpHandler) %s NOT FOR THIS SERVER: hwaddr=%s, serverid=%s",
+				msg.MessageType, hwaddr.String(), sid)
+			tx.Drop("message for another server")
+			return
+		}
 	}
 
-	if len(subnet.DNS) > 0 {
-		modifiers = append(modifiers, dhcpv6.WithDNS(subnet.DNS...))
+	chain := subnet.Chain
+	if chain == nil {
+		// subnet built without the options parser
+		chain, err = Plugins.Chain(subnet.Plugins)
 	}
-	if len(subnet.NTP) > 0 {
-		so := dhcpv6.NTPSuboptionSrvAddr(subnet.NTP[0])
-		modifiers = append(modifiers, dhcpv6.WithOption(&so))
+	if err != nil {
+		log.Errorf("(dhcpv6.dhcpHandler) invalid plugins of subnet <%s>: %v", lease.SubnetKey, err)
+		tx.Drop("invalid plugins")
+		return
 	}
-
-	//if match.Hostname != "" {
-	//	modifiers = append(modifiers,
-	//		dhcpv6.WithFQDN(0, match.Hostname),
-	//	)
-	//}
+	pc := &PluginContext{Request: msg, HWAddr: hwaddr, Lease: lease, Subnet: subnet, Modifiers: []dhcpv6.Modifier{dhcpv6.WithServerID(serverID)}}
+	if !dhcp.RunChain(chain, pc) {
+		log.Debugf("(dhcpv6.dhcpHandler) reply to hwaddr [%s] dropped by the plugin chain", hwaddr.String())
+		tx.Drop("dropped by the plugin chain")
+		return
+	}
+	modifiers := pc.Modifiers
 
 	var resp *dhcpv6.Message
 
 	switch msg.MessageType { //nolint:exhaustive
 	case dhcpv6.MessageTypeSolicit:
+		modifiers = append(modifiers, withIANA(msg, lease, subnet), withIAPD(msg, lease, subnet))
 		if msg.GetOneOption(dhcpv6.OptionRapidCommit) == nil {
 			log.Debugf("(dhcpv6.dhcpHandler) DHCPSOLICIT: %+v", msg)
 			resp, err = dhcpv6.NewAdvertiseFromSolicit(msg, modifiers...)
@@ -358,30 +559,279 @@ func (a *DHCPAllocator) dhcpHandler(conn net.PacketConn, peer net.Addr, m dhcpv6
 			resp, err = dhcpv6.NewReplyFromMessage(msg, modifiers...)
 			log.Debugf("(dhcpv6.dhcpHandler) DHCPREPLY: %+v", resp)
 		}
-	default:
-		log.Debugf("(dhcpv6.dhcpHandler) DHCPREQUEST: %+v", msg)
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRebind:
+		log.Debugf("(dhcpv6.dhcpHandler) DHCP%s: %+v", strings.ToUpper(msg.MessageType.String()), msg)
+		modifiers = append(modifiers, withIANA(msg, lease, subnet), withIAPD(msg, lease, subnet))
 		resp, err = dhcpv6.NewReplyFromMessage(msg, modifiers...)
 		log.Debugf("(dhcpv6.dhcpHandler) DHCPREPLY: %+v", resp)
+	case dhcpv6.MessageTypeInformationRequest:
+		// stateless configuration, reply without IA_NA
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPINFORMATIONREQUEST: %+v", msg)
+		resp, err = dhcpv6.NewReplyFromMessage(msg, modifiers...)
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPREPLY: %+v", resp)
+	case dhcpv6.MessageTypeConfirm:
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPCONFIRM: %+v", msg)
+		status, ok := confirmStatus(msg, subnet)
+		if !ok {
+			// no addresses to confirm, the server must not reply
+			tx.Drop("no addresses to confirm")
+			return
+		}
+		resp, err = dhcpv6.NewReplyFromMessage(msg, dhcpv6.WithServerID(serverID), dhcpv6.WithOption(status))
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPREPLY: %+v", resp)
+	case dhcpv6.MessageTypeRelease:
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPRELEASE: %+v", msg)
+		log.Infof("(dhcpv6.dhcpHandler) DHCPRELEASE: hwaddr=%s, clientip=%s", hwaddr.String(), lease.ClientIP.String())
+		resp, err = newReply(msg, dhcpv6.WithServerID(serverID), dhcpv6.WithOption(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusSuccess,
+			StatusMessage: "release received",
+		}))
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPREPLY: %+v", resp)
+	case dhcpv6.MessageTypeDecline:
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPDECLINE: %+v", msg)
+		log.Warnf("(dhcpv6.dhcpHandler) DHCPDECLINE: hwaddr=%s, clientip=%s, the address may already be in use",
+			hwaddr.String(), lease.ClientIP.String())
+		resp, err = newReply(msg, dhcpv6.WithServerID(serverID), dhcpv6.WithOption(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusSuccess,
+			StatusMessage: "decline received",
+		}))
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPREPLY: %+v", resp)
+	default:
+		log.Debugf("(dhcpv6.dhcpHandler) UNSUPPORTED MESSAGE TYPE %s: hwaddr=%s", msg.MessageType, hwaddr.String())
+		tx.Drop("unhandled message type")
+		return
 	}
 
 	if err != nil {
 		log.Errorf("(dhcpv6.dhcpHandler) Failure building response: %s", err)
+		tx.Drop("cannot build the reply")
 		return
 	}
 
-	ianaRequest := msg.Options.OneIANA()
-	if ianaRequest != nil {
-		ianaResponse := resp.Options.OneIANA()
-		ianaResponse.IaId = ianaRequest.IaId
-		resp.UpdateOption(ianaResponse)
+	switch msg.MessageType { //nolint:exhaustive
+	case dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew,
+		dhcpv6.MessageTypeRebind, dhcpv6.MessageTypeInformationRequest:
+		a.setReconfigureKey(conn, peer, m, msg, resp, hwaddr)
+	}
+
+	var out dhcpv6.DHCPv6 = resp
+	if m.IsRelay() {
+		// wrap the response into Relay-Reply messages, the interface-id and peer address are copied from the Relay-Forward
+		out, err = dhcpv6.NewRelayReplFromRelayForw(m.(*dhcpv6.RelayMessage), resp)
+		if err != nil {
+			log.Errorf("(dhcpv6.dhcpHandler) Failure building relay reply: %s", err)
+			tx.Drop("cannot build the relay reply")
+			return
+		}
+		log.Debugf("(dhcpv6.dhcpHandler) DHCPRELAYREPLY: %+v", out)
 	}
 
-	_, err = conn.WriteTo(resp.ToBytes(), peer)
+	_, err = conn.WriteTo(out.ToBytes(), peer)
 	if err != nil {
 		log.Errorf("(dhcpv6.dhcpHandler) Failure sending response: %s", err)
+		tx.Drop("cannot send the reply")
+		return
+	}
+	tx.ReplyType = resp.MessageType.String()
+	_, validLifetime := subnet.Lifetimes()
+	a.updateLeaseStatus(hwaddr.String(), msg, resp, validLifetime)
+}
+
+// newReply Build a reply to the client message, NewReplyFromMessage does not support Decline
+func newReply(msg *dhcpv6.Message, modifiers ...dhcpv6.Modifier) (*dhcpv6.Message, error) {
+	if msg.MessageType != dhcpv6.MessageTypeDecline {
+		return dhcpv6.NewReplyFromMessage(msg, modifiers...)
+	}
+	cid := msg.GetOneOption(dhcpv6.OptionClientID)
+	if cid == nil {
+		return nil, errors.New("client ID cannot be nil when building REPLY")
+	}
+	resp := &dhcpv6.Message{
+		MessageType:   dhcpv6.MessageTypeReply,
+		TransactionID: msg.TransactionID,
+	}
+	resp.AddOption(cid)
+	for _, modifier := range modifiers {
+		modifier(resp)
+	}
+	return resp, nil
+}
+
+// Lifetimes Returns the preferred and valid lifetimes of the addresses and prefixes
+func (s OVNSubnet) Lifetimes() (time.Duration, time.Duration) {
+	validLifetime := s.ValidLifetime
+	if validLifetime <= 0 {
+		validLifetime = s.LeaseTime
+	}
+	preferredLifetime := s.PreferredLifetime
+	if preferredLifetime <= 0 || preferredLifetime > validLifetime {
+		preferredLifetime = validLifetime
+	}
+	return time.Duration(preferredLifetime) * time.Second, time.Duration(validLifetime) * time.Second
+}
+
+// RenewalTimes Returns T1 and T2 of IA_NA and IA_PD, 0 lets the client choose them
+func (s OVNSubnet) RenewalTimes() (time.Duration, time.Duration) {
+	return time.Duration(s.RenewalTime) * time.Second, time.Duration(s.RebindingTime) * time.Second
+}
+
+// withIANA Answer every IA_NA of the client message.
+// The leased address is assigned to the first IA_NA in Solicit and Request, the others get NoAddrsAvail.
+// In Renew and Rebind, an IA_NA without the leased address is unknown and gets NoBinding,
+// addresses other than the leased one are returned with zero lifetimes so that the client stops using them.
+func withIANA(msg *dhcpv6.Message, lease DHCPLease, subnet OVNSubnet) dhcpv6.Modifier {
+	return func(d dhcpv6.DHCPv6) {
+		resp, ok := d.(*dhcpv6.Message)
+		if !ok {
+			return
+		}
+		preferredLifetime, validLifetime := subnet.Lifetimes()
+		leaseAddr := &dhcpv6.OptIAAddress{
+			IPv6Addr:          lease.ClientIP,
+			PreferredLifetime: preferredLifetime,
+			ValidLifetime:     validLifetime,
+		}
+
+		requests := msg.Options.IANA()
+		if len(requests) == 0 && len(msg.Options.IAPD()) == 0 &&
+			(msg.MessageType == dhcpv6.MessageTypeSolicit || msg.MessageType == dhcpv6.MessageTypeRequest) {
+			requests = []*dhcpv6.OptIANA{{}}
+		}
+
+		assigned := false
+		for _, request := range requests {
+			ia := &dhcpv6.OptIANA{IaId: request.IaId}
+			switch msg.MessageType { //nolint:exhaustive
+			case dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRebind:
+				known := false
+				for _, addr := range request.Options.Addresses() {
+					if addr.IPv6Addr.Equal(lease.ClientIP) {
+						known = true
+						continue
+					}
+					ia.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: addr.IPv6Addr})
+				}
+				if known {
+					ia.T1, ia.T2 = subnet.RenewalTimes()
+					ia.Options.Add(leaseAddr)
+				} else if msg.MessageType == dhcpv6.MessageTypeRenew || len(ia.Options.Options) == 0 {
+					ia.Options = dhcpv6.IdentityOptions{}
+					ia.Options.Add(&dhcpv6.OptStatusCode{
+						StatusCode:    iana.StatusNoBinding,
+						StatusMessage: "no binding for this IA",
+					})
+				}
+			default:
+				if assigned {
+					ia.Options.Add(&dhcpv6.OptStatusCode{
+						StatusCode:    iana.StatusNoAddrsAvail,
+						StatusMessage: "only one address is available for this client",
+					})
+					break
+				}
+				ia.T1, ia.T2 = subnet.RenewalTimes()
+				ia.Options.Add(leaseAddr)
+				assigned = true
+			}
+			resp.AddOption(ia)
+		}
 	}
 }
 
+// confirmStatus Returns NotOnLink if any address of the Confirm message is not on the link of the subnet,
+// false if the message does not contain any address
+func confirmStatus(msg *dhcpv6.Message, subnet OVNSubnet) (*dhcpv6.OptStatusCode, bool) {
+	found := false
+	for _, ia := range msg.Options.IANA() {
+		for _, addr := range ia.Options.Addresses() {
+			found = true
+			if subnet.CIDR != nil && !subnet.CIDR.Contains(addr.IPv6Addr) {
+				return &dhcpv6.OptStatusCode{
+					StatusCode:    iana.StatusNotOnLink,
+					StatusMessage: fmt.Sprintf("%s is not on link", addr.IPv6Addr),
+				}, true
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	return &dhcpv6.OptStatusCode{StatusCode: iana.StatusSuccess, StatusMessage: "all addresses are on link"}, true
+}
+
+// ntpServerOption Returns the NTP server option (RFC 5908) with an address suboption
+// for each server address and an FQDN suboption for each server name, nil if none
+func ntpServerOption(subnet OVNSubnet) *dhcpv6.OptNTPServer {
+	if len(subnet.NTP) == 0 && len(subnet.NTPFQDN) == 0 {
+		return nil
+	}
+	ntp := &dhcpv6.OptNTPServer{}
+	for _, ip := range subnet.NTP {
+		addr := dhcpv6.NTPSuboptionSrvAddr(ip)
+		ntp.Suboptions.Add(&addr)
+	}
+	for _, name := range subnet.NTPFQDN {
+		ntp.Suboptions.Add(&dhcpv6.NTPSuboptionSrvFQDN{Labels: rfc1035label.Labels{Labels: []string{name}}})
+	}
+	return ntp
+}
+
+// getClientAddr Returns the relay link address of a relayed message, otherwise the global source address of the client
+func getClientAddr(peer net.Addr, m dhcpv6.DHCPv6) net.IP {
+	if linkAddr := getRelayLinkAddr(m); linkAddr != nil {
+		return linkAddr
+	}
+	if udpAddr, ok := peer.(*net.UDPAddr); ok && !m.IsRelay() && udpAddr.IP.IsGlobalUnicast() {
+		return udpAddr.IP
+	}
+	return nil
+}
+
+// serverDUID Returns the server identifier of the subnet
+func serverDUID(subnet OVNSubnet) dhcpv6.DUID {
+	if subnet.ServerDUID != nil {
+		return subnet.ServerDUID
+	}
+	serverMac, _ := net.ParseMAC(subnet.ServerMac)
+	return &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: serverMac}
+}
+
+// getRelayLinkAddr Returns the link address of the relay agent closest to the client,
+// nil if the message is not relayed or the relay agent left it unspecified (e.g. a lightweight relay agent)
+func getRelayLinkAddr(m dhcpv6.DHCPv6) net.IP {
+	if !m.IsRelay() {
+		return nil
+	}
+	inner, err := dhcpv6.DecapsulateRelayIndex(m, -1)
+	if err != nil {
+		return nil
+	}
+	relay, ok := inner.(*dhcpv6.RelayMessage)
+	if !ok || relay.LinkAddr == nil || relay.LinkAddr.IsUnspecified() {
+		return nil
+	}
+	return relay.LinkAddr
+}
+
+// fqdnModifier Answer the client FQDN option 39, the server does not perform DNS updates
+func fqdnModifier(msg *dhcpv6.Message, lease DHCPLease, subnet OVNSubnet) dhcpv6.Modifier {
+	hostname, fqdn, err := dhcp.RenderHostname(lease.VMKey, lease.SubnetKey, subnet.FQDNTemplate, "")
+	if err != nil {
+		log.Warnf("(dhcpv6.fqdnModifier) render FQDN of vm <%s> failed: %v", lease.VMKey, err)
+	}
+	if fqdn == "" {
+		fqdn = hostname
+	}
+	if fqdn == "" {
+		return nil
+	}
+	flags := fqdnFlagN
+	if clientFQDN := msg.Options.FQDN(); clientFQDN != nil && clientFQDN.Flags&fqdnFlagS != 0 {
+		flags |= fqdnFlagO
+	}
+	return dhcpv6.WithFQDN(flags, fqdn)
+}
+
 func (a *DHCPAllocator) HasDHCPServer(nic string) bool {
 	a.mutex.RLock()
 	_, exist := a.servers[nic]
@@ -412,7 +862,10 @@ func (a *DHCPAllocator) AddAndRun(nic string) error {
 		opt = server6.WithDebugLogger()
 	}
 
-	server, err := server6.NewServer(nic, &addr, a.dhcpHandler, opt)
+	handler := func(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6) {
+		a.dhcpHandler(nic, conn, peer, m)
+	}
+	server, err := server6.NewServer(nic, &addr, handler, opt)
 	if err != nil {
 		return fmt.Errorf("error new DHCPv6 server on nic <%s>: %v", nic, err)
 	}
@@ -428,6 +881,9 @@ func (a *DHCPAllocator) AddAndRun(nic string) error {
 		cancelFunc: cancelFunc,
 	}
 
+	// router advertisements are only sent for the subnets that enable them
+	go a.runRouterAdvertisement(ctx, nic)
+
 	go func() {
 		select {
 		case <-a.ctx.Done():
@@ -0,0 +1,379 @@
+package v6
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithIANA(t *testing.T) {
+	leaseIP := net.ParseIP("2001:db8::10")
+	foreignIP := net.ParseIP("2001:db9::10")
+	lease := DHCPLease{ClientIP: leaseIP}
+	subnet := OVNSubnet{LeaseTime: 3600}
+
+	newIANA := func(addrs ...net.IP) *dhcpv6.OptIANA {
+		ia := &dhcpv6.OptIANA{IaId: [4]byte{0, 0, 0, 1}}
+		for _, addr := range addrs {
+			ia.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: addr})
+		}
+		return ia
+	}
+
+	tests := []struct {
+		messageType dhcpv6.MessageType
+		iana        *dhcpv6.OptIANA
+		wantAddrs   []net.IP
+		wantZero    []net.IP
+		wantStatus  iana.StatusCode
+	}{
+		{
+			messageType: dhcpv6.MessageTypeRequest,
+			iana:        newIANA(),
+			wantAddrs:   []net.IP{leaseIP},
+		},
+		{
+			messageType: dhcpv6.MessageTypeRenew,
+			iana:        newIANA(leaseIP),
+			wantAddrs:   []net.IP{leaseIP},
+		},
+		{
+			messageType: dhcpv6.MessageTypeRenew,
+			iana:        newIANA(foreignIP),
+			wantStatus:  iana.StatusNoBinding,
+		},
+		{
+			messageType: dhcpv6.MessageTypeRebind,
+			iana:        newIANA(foreignIP),
+			wantZero:    []net.IP{foreignIP},
+		},
+		{
+			messageType: dhcpv6.MessageTypeRebind,
+			iana:        newIANA(),
+			wantStatus:  iana.StatusNoBinding,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			msg := &dhcpv6.Message{MessageType: test.messageType}
+			msg.AddOption(test.iana)
+			resp := &dhcpv6.Message{MessageType: dhcpv6.MessageTypeReply}
+			withIANA(msg, lease, subnet)(resp)
+
+			ia := resp.Options.OneIANA()
+			assert.NotNil(t, ia)
+			assert.Equal(t, test.iana.IaId, ia.IaId)
+			var addrs, zero []net.IP
+			for _, addr := range ia.Options.Addresses() {
+				if addr.ValidLifetime == 0 {
+					zero = append(zero, addr.IPv6Addr)
+				} else {
+					addrs = append(addrs, addr.IPv6Addr)
+				}
+			}
+			assert.Equal(t, test.wantAddrs, addrs)
+			assert.Equal(t, test.wantZero, zero)
+			if status := ia.Options.Status(); status != nil {
+				assert.Equal(t, test.wantStatus, status.StatusCode)
+			} else {
+				assert.Equal(t, iana.StatusSuccess, test.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_ConfirmStatus(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("2001:db8::/64")
+	subnet := OVNSubnet{CIDR: cidr}
+
+	msg := &dhcpv6.Message{MessageType: dhcpv6.MessageTypeConfirm}
+	_, ok := confirmStatus(msg, subnet)
+	assert.False(t, ok)
+
+	ia := &dhcpv6.OptIANA{}
+	ia.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::10")})
+	msg.AddOption(ia)
+	status, ok := confirmStatus(msg, subnet)
+	assert.True(t, ok)
+	assert.Equal(t, iana.StatusSuccess, status.StatusCode)
+
+	ia.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db9::10")})
+	status, ok = confirmStatus(msg, subnet)
+	assert.True(t, ok)
+	assert.Equal(t, iana.StatusNotOnLink, status.StatusCode)
+}
+
+func Test_DelegatePrefix(t *testing.T) {
+	_, pool, _ := net.ParseCIDR("2001:db8:100::/48")
+	subnet := OVNSubnet{DelegatedPrefixPool: pool, DelegatedPrefixLen: 64}
+	a := NewDHCPAllocator(context.TODO())
+	delegate := func(mac, clientIP string, requested *net.IPNet) (*net.IPNet, error) {
+		prefix, err := a.DelegatePrefix(mac, subnet, net.ParseIP(clientIP), requested)
+		if err == nil {
+			err = a.AddPodDHCPLease(mac, "default/"+mac, DHCPLease{ClientIP: net.ParseIP(clientIP), SubnetKey: "subnet1", Prefix: prefix})
+		}
+		return prefix, err
+	}
+
+	prefix, err := delegate("00:00:00:00:00:01", "2001:db8::10", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:100:10::/64", prefix.String())
+	// the low 16 bits of the address are the same, the next free prefix is delegated
+	prefix, err = delegate("00:00:00:00:00:02", "2001:db8::1:10", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:100:11::/64", prefix.String())
+	// a hardware address keeps its prefix
+	prefix, err = delegate("00:00:00:00:00:02", "2001:db8::1:10", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:100:11::/64", prefix.String())
+
+	// the prefix of the pod annotation must not overlap a delegated prefix
+	_, requested, _ := net.ParseCIDR("2001:db8:100:10::/60")
+	_, err = delegate("00:00:00:00:00:03", "2001:db8::20", requested)
+	assert.ErrorIs(t, err, ErrPrefixOverlap)
+	err = a.AddPodDHCPLease("00:00:00:00:00:03", "default/pod3", DHCPLease{ClientIP: net.ParseIP("2001:db8::20"), SubnetKey: "subnet1", Prefix: requested})
+	assert.ErrorIs(t, err, ErrPrefixOverlap)
+	_, requested, _ = net.ParseCIDR("2001:db8:200::/56")
+	prefix, err = delegate("00:00:00:00:00:03", "2001:db8::20", requested)
+	assert.NoError(t, err)
+	assert.Equal(t, requested, prefix)
+
+	// no pool
+	prefix, err = a.DelegatePrefix("00:00:00:00:00:04", OVNSubnet{}, net.ParseIP("2001:db8::30"), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, prefix)
+
+	// a /63 pool holds two /64 prefixes
+	_, subnet.DelegatedPrefixPool, _ = net.ParseCIDR("2001:db8:300::/63")
+	_, err = delegate("00:00:00:00:00:04", "2001:db8::30", nil)
+	assert.NoError(t, err)
+	_, err = delegate("00:00:00:00:00:05", "2001:db8::40", nil)
+	assert.NoError(t, err)
+	_, err = delegate("00:00:00:00:00:06", "2001:db8::50", nil)
+	assert.Error(t, err)
+}
+
+func Test_LookupLease(t *testing.T) {
+	a := NewDHCPAllocator(context.TODO())
+	hwaddr, _ := net.ParseMAC("00:00:00:2e:2f:b8")
+	lease := DHCPLease{ClientIP: net.ParseIP("2001:db8::10"), SubnetKey: "subnet1"}
+	assert.NoError(t, a.AddPodDHCPLease(hwaddr.String(), "default/pod1", lease))
+
+	msg := &dhcpv6.Message{MessageType: dhcpv6.MessageTypeSolicit}
+	msg.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDUUID{UUID: [16]byte{1, 2, 3}}))
+
+	// unknown client DUID from a global address
+	global := &net.UDPAddr{IP: net.ParseIP("2001:db8::99"), Port: dhcpv6.DefaultClientPort}
+	_, _, ok := a.lookupLease(global, msg, msg)
+	assert.False(t, ok)
+
+	// learned from the EUI-64 link-local source address
+	linkLocal := &net.UDPAddr{IP: net.ParseIP("fe80::200:ff:fe2e:2fb8"), Port: dhcpv6.DefaultClientPort}
+	found, foundLease, ok := a.lookupLease(linkLocal, msg, msg)
+	assert.True(t, ok)
+	assert.Equal(t, hwaddr, found)
+	assert.Equal(t, lease.ClientIP, foundLease.ClientIP)
+
+	// matched by the learned DUID binding
+	found, _, ok = a.lookupLease(global, msg, msg)
+	assert.True(t, ok)
+	assert.Equal(t, hwaddr, found)
+
+	// the binding is removed with the lease
+	assert.NoError(t, a.DeletePodDHCPLease("default/pod1"))
+	_, ok = a.getDUIDBinding(hex.EncodeToString(msg.Options.ClientID().ToBytes()))
+	assert.False(t, ok)
+}
+
+func Test_BuildRouterAdvertisement(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("2001:db8::/64")
+	subnets := []OVNSubnet{{
+		ServerMac:         "00:00:00:2e:2f:b8",
+		CIDR:              cidr,
+		MTU:               1400,
+		DNS:               []net.IP{net.ParseIP("2400:3200::1")},
+		DomainSearch:      []string{"example.com"},
+		LeaseTime:         3600,
+		ValidLifetime:     7200,
+		PreferredLifetime: 1800,
+		RA:                RouterAdvertisement{Enabled: true, Managed: true, Other: true, RouterLifetime: 1800 * time.Second},
+	}}
+
+	b := buildRouterAdvertisement(subnets, false)
+	assert.Equal(t, byte(134), b[0])
+	assert.Equal(t, byte(0xc0), b[5])
+	assert.Equal(t, uint16(1800), binary.BigEndian.Uint16(b[6:8]))
+	// the options are a whole number of 8 bytes units
+	options := map[byte][]byte{}
+	for i := 16; i < len(b); {
+		length := int(b[i+1]) * 8
+		assert.NotZero(t, length)
+		options[b[i]] = b[i : i+length]
+		i += length
+	}
+	assert.Equal(t, []byte{0, 0, 0, 0x2e, 0x2f, 0xb8}, options[1][2:8])
+	assert.Equal(t, uint32(1400), binary.BigEndian.Uint32(options[5][4:8]))
+	assert.Equal(t, byte(64), options[3][2])
+	assert.Equal(t, byte(0x80), options[3][3])
+	assert.Equal(t, cidr.IP.To16(), net.IP(options[3][16:32]))
+	// the prefix lifetimes are the lifetimes of the subnet
+	assert.Equal(t, uint32(7200), binary.BigEndian.Uint32(options[3][4:8]))
+	assert.Equal(t, uint32(1800), binary.BigEndian.Uint32(options[3][8:12]))
+	assert.Equal(t, net.ParseIP("2400:3200::1"), net.IP(options[25][8:24]))
+	assert.Contains(t, string(options[31][8:]), "example")
+
+	b = buildRouterAdvertisement(subnets, true)
+	assert.Equal(t, uint16(0), binary.BigEndian.Uint16(b[6:8]))
+}
+
+func Test_NTPServerOption(t *testing.T) {
+	assert.Nil(t, ntpServerOption(OVNSubnet{}))
+
+	ntp := ntpServerOption(OVNSubnet{
+		NTP:     []net.IP{net.ParseIP("2001:db8::123"), net.ParseIP("2001:db8::124")},
+		NTPFQDN: []string{"ntp.example.com"},
+	})
+	assert.Len(t, ntp.Suboptions, 3)
+
+	parsed := &dhcpv6.OptNTPServer{}
+	assert.NoError(t, parsed.FromBytes(ntp.ToBytes()))
+	assert.Equal(t, dhcpv6.NTPSuboptionSrvFQDNCode, parsed.Suboptions[2].Code())
+}
+
+// packetConn records the replies written by the handler
+type packetConn struct {
+	net.PacketConn
+	replies []dhcpv6.DHCPv6
+	peers   []net.Addr
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	reply, err := dhcpv6.FromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	c.replies = append(c.replies, reply)
+	c.peers = append(c.peers, addr)
+	return len(b), nil
+}
+
+var testHWAddr = net.HardwareAddr{0x52, 0x54, 0x00, 0xa1, 0xb2, 0xc3}
+
+// newTestAllocator Returns an allocator leasing 2001:db8::10 of subnet1 to the pod default/pod1
+func newTestAllocator(t *testing.T, subnet OVNSubnet) *DHCPAllocator {
+	a := NewDHCPAllocator(context.TODO())
+	_, cidr, _ := net.ParseCIDR("2001:db8::/64")
+	subnet.ServerMac = "00:00:00:2e:2f:b8"
+	subnet.ServerIP = net.ParseIP("2001:db8::1")
+	subnet.CIDR = cidr
+	subnet.LeaseTime = 3600
+	subnet.Interface = "net1"
+	a.AddOrUpdateSubnet("subnet1", subnet)
+	lease := DHCPLease{ClientIP: net.ParseIP("2001:db8::10"), SubnetKey: "subnet1", VMKey: "default/vm1"}
+	assert.NoError(t, a.AddPodDHCPLease(testHWAddr.String(), "default/pod1", lease))
+	return a
+}
+
+func Test_RelayedSolicit(t *testing.T) {
+	tests := []struct {
+		linkAddr string
+		wantDrop bool
+	}{
+		{
+			linkAddr: "2001:db8::fe",
+		},
+		{
+			// a lightweight relay agent leaves the link address unspecified
+			linkAddr: "::",
+		},
+		{
+			linkAddr: "2001:db9::fe",
+			wantDrop: true,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			a := newTestAllocator(t, OVNSubnet{})
+			solicit, err := dhcpv6.NewSolicit(testHWAddr)
+			assert.NoError(t, err)
+			relay, err := dhcpv6.EncapsulateRelay(solicit, dhcpv6.MessageTypeRelayForward,
+				net.ParseIP(test.linkAddr), net.ParseIP("fe80::5054:ff:fea1:b2c3"))
+			assert.NoError(t, err)
+			relay.AddOption(dhcpv6.OptInterfaceID([]byte("eth0")))
+			peer := &net.UDPAddr{IP: net.ParseIP("2001:db8::fe"), Port: dhcpv6.DefaultServerPort}
+
+			conn := &packetConn{}
+			a.dhcpHandler("net1", conn, peer, relay)
+			if test.wantDrop {
+				assert.Empty(t, conn.replies)
+				return
+			}
+			assert.Len(t, conn.replies, 1)
+			assert.Equal(t, peer, conn.peers[0])
+			reply, ok := conn.replies[0].(*dhcpv6.RelayMessage)
+			assert.True(t, ok)
+			assert.Equal(t, dhcpv6.MessageTypeRelayReply, reply.Type())
+			assert.Equal(t, relay.PeerAddr, reply.PeerAddr)
+			// RFC 8415 19.3: the interface-id of the Relay-Forward is copied to the Relay-Reply
+			assert.Equal(t, []byte("eth0"), reply.Options.InterfaceID())
+			inner, err := reply.GetInnerMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, dhcpv6.MessageTypeAdvertise, inner.MessageType)
+			assert.Equal(t, solicit.TransactionID, inner.TransactionID)
+			assert.Equal(t, net.ParseIP("2001:db8::10"), inner.Options.OneIANA().Options.OneAddress().IPv6Addr)
+		})
+	}
+}
+
+func Test_StatelessInformationRequest(t *testing.T) {
+	tests := []struct {
+		nic      string
+		peer     string
+		wantDrop bool
+	}{
+		{
+			// link-local address without an EUI-64 interface identifier
+			nic:  "net1",
+			peer: "fe80::1234:5678",
+		},
+		{
+			nic:  "net2",
+			peer: "2001:db8::99",
+		},
+		{
+			nic:      "net2",
+			peer:     "fe80::1234:5678",
+			wantDrop: true,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			a := newTestAllocator(t, OVNSubnet{Stateless: true, DNS: []net.IP{net.ParseIP("2400:3200::1")}})
+			msg, err := dhcpv6.NewMessage(dhcpv6.WithClientID(&dhcpv6.DUIDUUID{UUID: [16]byte{1, 2, 3}}))
+			assert.NoError(t, err)
+			msg.MessageType = dhcpv6.MessageTypeInformationRequest
+			peer := &net.UDPAddr{IP: net.ParseIP(test.peer), Port: dhcpv6.DefaultClientPort, Zone: test.nic}
+
+			conn := &packetConn{}
+			a.dhcpHandler(test.nic, conn, peer, msg)
+			if test.wantDrop {
+				assert.Empty(t, conn.replies)
+				return
+			}
+			assert.Len(t, conn.replies, 1)
+			reply, ok := conn.replies[0].(*dhcpv6.Message)
+			assert.True(t, ok)
+			assert.Equal(t, dhcpv6.MessageTypeReply, reply.MessageType)
+			assert.Equal(t, []net.IP{net.ParseIP("2400:3200::1")}, reply.Options.DNS())
+			assert.Nil(t, reply.Options.OneIANA())
+		})
+	}
+}
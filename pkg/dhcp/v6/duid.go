@@ -0,0 +1,122 @@
+package v6
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// DUIDConfigMapName name of the ConfigMap that persists the server DUID of each network provider
+const DUIDConfigMapName = "dcloud-dhcp-controller-duid"
+
+// DUIDStore Persist the DHCPv6 server DUID in a ConfigMap,
+// so that every replica presents the same server identifier after a leader failover
+type DUIDStore struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	mutex      sync.Mutex
+	cache      map[string]dhcpv6.DUID // provider -> duid
+	pending    map[string]bool        // providers whose cached duid is not persisted yet
+}
+
+func NewDUIDStore(kubeClient kubernetes.Interface, namespace string) *DUIDStore {
+	return &DUIDStore{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		cache:      make(map[string]dhcpv6.DUID),
+		pending:    make(map[string]bool),
+	}
+}
+
+// GetOrCreate Returns the persisted DUID of the network provider, a new DUID-LL is generated
+// from hwAddr and stored if none exists. If the ConfigMap cannot be accessed, the DUID-LL is
+// used and kept for the lifetime of the process, it is persisted by a later call.
+func (s *DUIDStore) GetOrCreate(ctx context.Context, provider string, hwAddr net.HardwareAddr) dhcpv6.DUID {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cached, ok := s.cache[provider]
+	if ok && !s.pending[provider] {
+		return cached
+	}
+	candidate := cached
+	if !ok {
+		candidate = &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: hwAddr}
+	}
+
+	duid, err := s.loadOrStore(ctx, duidConfigMapKey(provider), candidate)
+	if err != nil {
+		log.Warnf("(dhcpv6.GetOrCreate) Unable to persist the server DUID of network provider <%s>, use DUID <%s> until it is: %v",
+			provider, candidate.String(), err)
+		s.cache[provider] = candidate
+		s.pending[provider] = true
+		return candidate
+	}
+	delete(s.pending, provider)
+	if ok && !duid.Equal(cached) {
+		// the server identifier must not change while the guests hold their leases
+		log.Warnf("(dhcpv6.GetOrCreate) Network provider <%s> keeps DUID <%s>, the persisted DUID <%s> is used after a restart",
+			provider, cached.String(), duid.String())
+		return cached
+	}
+	s.cache[provider] = duid
+	return duid
+}
+
+// loadOrStore Returns the DUID stored in key, candidate is stored if there is none
+func (s *DUIDStore) loadOrStore(ctx context.Context, key string, candidate dhcpv6.DUID) (dhcpv6.DUID, error) {
+	var duid dhcpv6.DUID
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, DUIDConfigMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: DUIDConfigMapName, Namespace: s.namespace}}
+			cm, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), DUIDConfigMapName, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if value, ok := cm.Data[key]; ok {
+			if duid, err = parseDUID(value); err == nil {
+				return nil
+			}
+			log.Warnf("(dhcpv6.loadOrStore) Invalid server DUID <%s> in key <%s>, regenerate it: %v", value, key, err)
+		}
+
+		duid = candidate
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = hex.EncodeToString(duid.ToBytes())
+		_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	return duid, err
+}
+
+func parseDUID(value string) (dhcpv6.DUID, error) {
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return dhcpv6.DUIDFromBytes(data)
+}
+
+// duidConfigMapKey ConfigMap keys only allow alphanumerics, '-', '_' and '.'
+func duidConfigMapKey(provider string) string {
+	return strings.ReplaceAll(provider, "/", ".")
+}
@@ -0,0 +1,48 @@
+package v6
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_DUIDStore(t *testing.T) {
+	ctx := context.TODO()
+	macA, _ := net.ParseMAC("00:00:00:2e:2f:b8")
+	macB, _ := net.ParseMAC("00:00:00:2e:2f:b9")
+
+	// persisted on first use, reloaded by another replica with another server mac
+	kubeClient := fake.NewSimpleClientset()
+	duid := NewDUIDStore(kubeClient, "dcloud").GetOrCreate(ctx, "default/provider", macA)
+	reloaded := NewDUIDStore(kubeClient, "dcloud").GetOrCreate(ctx, "default/provider", macB)
+	assert.True(t, duid.Equal(reloaded))
+	cm, err := kubeClient.CoreV1().ConfigMaps("dcloud").Get(ctx, DUIDConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data, "default.provider")
+
+	// the fallback is kept while the API server is unavailable, then persisted
+	kubeClient = fake.NewSimpleClientset()
+	unavailable := true
+	kubeClient.PrependReactor("*", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if unavailable {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	store := NewDUIDStore(kubeClient, "dcloud")
+	fallback := store.GetOrCreate(ctx, "default/provider", macA)
+	assert.Equal(t, &dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: macA}, fallback)
+	assert.True(t, fallback.Equal(store.GetOrCreate(ctx, "default/provider", macA)))
+	unavailable = false
+	assert.True(t, fallback.Equal(store.GetOrCreate(ctx, "default/provider", macA)))
+	reloaded = NewDUIDStore(kubeClient, "dcloud").GetOrCreate(ctx, "default/provider", macB)
+	assert.True(t, fallback.Equal(reloaded))
+}
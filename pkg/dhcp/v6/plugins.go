@@ -0,0 +1,113 @@
+package v6
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	log "github.com/sirupsen/logrus"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// PluginContext the request and the lease of the client, the plugins append the modifiers of the reply
+type PluginContext struct {
+	Request   *dhcpv6.Message // inner message of relayed requests
+	HWAddr    net.HardwareAddr
+	Lease     DHCPLease
+	Subnet    OVNSubnet
+	Modifiers []dhcpv6.Modifier
+}
+
+// Plugins the DHCPv6 reply pipeline, the subnet option plugins selects and orders them.
+// The server identifier, IA_NA and IA_PD are always handled by the server.
+var Plugins = &dhcp.Registry[*PluginContext]{}
+
+func init() {
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "dns", Handler: dnsPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "domain", Handler: domainPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "ntp", Handler: ntpPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "netboot", Handler: netBootPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "hostname", Handler: hostnamePlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "raw_options", Handler: rawOptionsPlugin})
+	Plugins.MustRegister(dhcp.Plugin[*PluginContext]{Name: "ratelimit", Handler: rateLimitPlugin, Optional: true})
+}
+
+// rateLimitPlugin drop the requests of a client exceeding the rate_limit option, list it first to skip the other plugins
+func rateLimitPlugin(c *PluginContext) bool {
+	if c.Subnet.RateLimiter == nil || c.Subnet.RateLimiter.Allow(c.HWAddr.String()) {
+		return false
+	}
+	log.Debugf("(dhcpv6.rateLimitPlugin) hwaddr [%s] exceeded the rate limit", c.HWAddr.String())
+	return true
+}
+
+// dnsPlugin option 23
+func dnsPlugin(c *PluginContext) bool {
+	if len(c.Subnet.DNS) > 0 {
+		c.Modifiers = append(c.Modifiers, dhcpv6.WithDNS(c.Subnet.DNS...))
+	}
+	return false
+}
+
+// domainPlugin option 24
+func domainPlugin(c *PluginContext) bool {
+	if len(c.Subnet.DomainSearch) > 0 {
+		c.Modifiers = append(c.Modifiers, dhcpv6.WithDomainSearchList(c.Subnet.DomainSearch...))
+	}
+	return false
+}
+
+// ntpPlugin option 56
+func ntpPlugin(c *PluginContext) bool {
+	if ntp := ntpServerOption(c.Subnet); ntp != nil {
+		c.Modifiers = append(c.Modifiers, dhcpv6.WithOption(ntp))
+	}
+	return false
+}
+
+// netBootPlugin options 59 and 60
+func netBootPlugin(c *PluginContext) bool {
+	if c.Subnet.BootFileURL == "" || !c.Request.IsOptionRequested(dhcpv6.OptionBootfileURL) {
+		return false
+	}
+	c.Modifiers = append(c.Modifiers, dhcpv6.WithOption(dhcpv6.OptBootFileURL(c.Subnet.BootFileURL)))
+	if len(c.Subnet.BootFileParams) > 0 {
+		c.Modifiers = append(c.Modifiers, dhcpv6.WithOption(dhcpv6.OptBootFileParam(c.Subnet.BootFileParams...)))
+	}
+	// UEFI HTTP boot clients expect the "HTTPClient" vendor class to be echoed
+	for _, vendorClass := range c.Request.Options.VendorClasses() {
+		if slices.ContainsFunc(vendorClass.Data, func(data []byte) bool {
+			return strings.HasPrefix(string(data), "HTTPClient")
+		}) {
+			c.Modifiers = append(c.Modifiers, dhcpv6.WithOption(&dhcpv6.OptVendorClass{
+				EnterpriseNumber: vendorClass.EnterpriseNumber,
+				Data:             [][]byte{[]byte("HTTPClient")},
+			}))
+			break
+		}
+	}
+	return false
+}
+
+// hostnamePlugin option 39
+func hostnamePlugin(c *PluginContext) bool {
+	if c.Subnet.Hostname && c.Lease.VMKey != "" &&
+		(c.Request.Options.FQDN() != nil || c.Request.IsOptionRequested(dhcpv6.OptionFQDN)) {
+		if modifier := fqdnModifier(c.Request, c.Lease, c.Subnet); modifier != nil {
+			c.Modifiers = append(c.Modifiers, modifier)
+		}
+	}
+	return false
+}
+
+// rawOptionsPlugin option_<code> options of the subnet
+func rawOptionsPlugin(c *PluginContext) bool {
+	for _, option := range c.Subnet.RawOptions {
+		c.Modifiers = append(c.Modifiers, dhcpv6.WithOption(&dhcpv6.OptionGeneric{
+			OptionCode: dhcpv6.OptionCode(option.Code),
+			OptionData: option.Value,
+		}))
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package v6
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// ErrPrefixOverlap the delegated prefix overlaps the prefix of another hardware address
+var ErrPrefixOverlap = errors.New("delegated prefix overlaps")
+
+// prefixAt Returns the index-th prefix of the delegated prefix pool
+func (s OVNSubnet) prefixAt(index *big.Int) *net.IPNet {
+	_, bits := s.DelegatedPrefixPool.Mask.Size()
+	prefix := new(big.Int).SetBytes(s.DelegatedPrefixPool.IP.To16())
+	prefix.Or(prefix, new(big.Int).Lsh(index, uint(bits-s.DelegatedPrefixLen)))
+	ip := make(net.IP, net.IPv6len)
+	prefix.FillBytes(ip)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(s.DelegatedPrefixLen, bits)}
+}
+
+// inPool The prefix is one of the prefixes of the delegated prefix pool
+func (s OVNSubnet) inPool(prefix *net.IPNet) bool {
+	ones, _ := prefix.Mask.Size()
+	return s.DelegatedPrefixPool != nil && ones == s.DelegatedPrefixLen && s.DelegatedPrefixPool.Contains(prefix.IP)
+}
+
+func prefixesOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// overlappingPrefix Returns the hardware address holding a prefix that overlaps the given one, must be called with the lock held
+func (a *DHCPAllocator) overlappingPrefix(hwAddr string, prefix *net.IPNet) (string, *net.IPNet, bool) {
+	for macAddr, lease := range a.leases {
+		if macAddr != hwAddr && lease.Prefix != nil && prefixesOverlap(lease.Prefix, prefix) {
+			return macAddr, lease.Prefix, true
+		}
+	}
+	return "", nil, false
+}
+
+// DelegatePrefix Returns the prefix delegated to the hardware address, nil if none.
+// The requested prefix of the pod annotation takes precedence over the pool of the subnet.
+// A hardware address keeps its prefix of the pool, a new one gets the first free prefix
+// starting at the low bits of the client address. Prefixes never overlap between hardware addresses.
+func (a *DHCPAllocator) DelegatePrefix(hwAddr string, subnet OVNSubnet, clientIP net.IP, requested *net.IPNet) (*net.IPNet, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	if requested != nil {
+		if macAddr, prefix, ok := a.overlappingPrefix(hwAddr, requested); ok {
+			return nil, fmt.Errorf("%w: prefix <%s> overlaps prefix <%s> of hardware address <%s>",
+				ErrPrefixOverlap, requested.String(), prefix.String(), macAddr)
+		}
+		return requested, nil
+	}
+	if subnet.DelegatedPrefixPool == nil || clientIP.To16() == nil {
+		return nil, nil
+	}
+	if lease, ok := a.leases[hwAddr]; ok && lease.Prefix != nil && subnet.inPool(lease.Prefix) {
+		return lease.Prefix, nil
+	}
+
+	ones, _ := subnet.DelegatedPrefixPool.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(subnet.DelegatedPrefixLen-ones))
+	index := new(big.Int).Mod(new(big.Int).SetBytes(clientIP.To16()), size)
+	// every other lease holds at most one prefix, so one of the next len(leases) prefixes is free
+	for i := 0; i < len(a.leases)+1 && big.NewInt(int64(i)).Cmp(size) < 0; i++ {
+		prefix := subnet.prefixAt(index)
+		if _, _, ok := a.overlappingPrefix(hwAddr, prefix); !ok {
+			return prefix, nil
+		}
+		index.Add(index, big.NewInt(1))
+		index.Mod(index, size)
+	}
+	return nil, fmt.Errorf("delegated prefix pool <%s> is exhausted", subnet.DelegatedPrefixPool.String())
+}
+
+// withIAPD Answer every IA_PD of the client message with the prefix delegated to the lease.
+// Only the first IA_PD gets the prefix. The other IA_PDs, and every IA_PD of a lease without a prefix,
+// get the status NoPrefixAvail in Solicit and Request, and NoBinding in Renew and Rebind.
+func withIAPD(msg *dhcpv6.Message, lease DHCPLease, subnet OVNSubnet) dhcpv6.Modifier {
+	return func(d dhcpv6.DHCPv6) {
+		resp, ok := d.(*dhcpv6.Message)
+		if !ok {
+			return
+		}
+		preferredLifetime, validLifetime := subnet.Lifetimes()
+
+		renewing := msg.MessageType == dhcpv6.MessageTypeRenew || msg.MessageType == dhcpv6.MessageTypeRebind
+
+		assigned := false
+		for _, request := range msg.Options.IAPD() {
+			iapd := &dhcpv6.OptIAPD{IaId: request.IaId}
+			if lease.Prefix != nil && !assigned {
+				// prefixes that are no longer delegated to the client must not be used,
+				// the prefixes of Solicit and Request are only hints
+				for _, prefix := range request.Options.Prefixes() {
+					if renewing && prefix.Prefix != nil && prefix.Prefix.String() != lease.Prefix.String() {
+						iapd.Options.Add(&dhcpv6.OptIAPrefix{Prefix: prefix.Prefix})
+					}
+				}
+				iapd.T1, iapd.T2 = subnet.RenewalTimes()
+				iapd.Options.Add(&dhcpv6.OptIAPrefix{
+					PreferredLifetime: preferredLifetime,
+					ValidLifetime:     validLifetime,
+					Prefix:            lease.Prefix,
+				})
+				assigned = true
+			} else if renewing {
+				iapd.Options.Add(&dhcpv6.OptStatusCode{
+					StatusCode:    iana.StatusNoBinding,
+					StatusMessage: "no binding for this IA_PD",
+				})
+			} else {
+				iapd.Options.Add(&dhcpv6.OptStatusCode{
+					StatusCode:    iana.StatusNoPrefixAvail,
+					StatusMessage: "no prefix available for this client",
+				})
+			}
+			resp.AddOption(iapd)
+		}
+	}
+}
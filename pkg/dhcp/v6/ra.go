@@ -0,0 +1,282 @@
+package v6
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// RFC 4861 default values, the prefix lifetimes are used by the subnets without a lease time
+const (
+	DefaultRAInterval              = 200 * time.Second // MaxRtrAdvInterval
+	DefaultPrefixValidLifetime     = 30 * 24 * time.Hour
+	DefaultPrefixPreferredLifetime = 7 * 24 * time.Hour
+
+	raHopLimit = 255
+)
+
+var (
+	allNodes   = net.ParseIP("ff02::1")
+	allRouters = net.ParseIP("ff02::2")
+)
+
+// RouterAdvertisement Router Advertisement settings of the subnet
+type RouterAdvertisement struct {
+	Enabled bool // send router advertisements on the provider interface
+	Managed bool // M flag, addresses are available via DHCPv6
+	Other   bool // O flag, other configuration is available via DHCPv6
+	// Autonomous A flag of the prefix information, the prefix can be used for SLAAC
+	Autonomous bool
+	// Interval maximum interval between unsolicited advertisements, default: 200s
+	Interval time.Duration
+	// RouterLifetime lifetime of the DHCP server as a default router, 0 means that it is not a default router.
+	// The next hop of a router advertisement is always its sender, so only set it if the provider interface forwards traffic.
+	RouterLifetime time.Duration
+}
+
+// RouterAdvertisementSubnets Returns the subnets served on the nic with router advertisements enabled
+func (a *DHCPAllocator) RouterAdvertisementSubnets(nic string) []OVNSubnet {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	var keys []string
+	for key, subnet := range a.subnets {
+		if subnet.Interface == nic && subnet.RA.Enabled {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	subnets := make([]OVNSubnet, 0, len(keys))
+	for _, key := range keys {
+		subnets = append(subnets, a.subnets[key])
+	}
+	return subnets
+}
+
+// runRouterAdvertisement Answer router solicitations and send unsolicited router advertisements on the nic
+// until ctx is done, a final advertisement with a zero router lifetime is sent on exit
+func (a *DHCPAllocator) runRouterAdvertisement(ctx context.Context, nic string) {
+	ifi, err := net.InterfaceByName(nic)
+	if err != nil {
+		log.Errorf("(dhcpv6.runRouterAdvertisement) cannot find nic <%s>: %v", nic, err)
+		return
+	}
+
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		log.Errorf("(dhcpv6.runRouterAdvertisement) cannot listen ICMPv6 on nic <%s>: %v", nic, err)
+		return
+	}
+	defer conn.Close()
+
+	p := conn.IPv6PacketConn()
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeRouterSolicitation)
+	if err = errors.Join(
+		p.SetICMPFilter(&filter),
+		p.SetControlMessage(ipv6.FlagInterface|ipv6.FlagHopLimit, true),
+		p.SetMulticastHopLimit(raHopLimit),
+		p.SetHopLimit(raHopLimit),
+		p.JoinGroup(ifi, &net.IPAddr{IP: allRouters}),
+	); err != nil {
+		log.Errorf("(dhcpv6.runRouterAdvertisement) cannot configure ICMPv6 socket on nic <%s>: %v", nic, err)
+		return
+	}
+
+	send := func(dst net.IP, final bool) {
+		subnets := a.RouterAdvertisementSubnets(nic)
+		if len(subnets) == 0 {
+			return
+		}
+		msg := buildRouterAdvertisement(subnets, final)
+		cm := &ipv6.ControlMessage{HopLimit: raHopLimit, IfIndex: ifi.Index}
+		if _, err := p.WriteTo(msg, cm, &net.IPAddr{IP: dst, Zone: nic}); err != nil {
+			log.Warnf("(dhcpv6.runRouterAdvertisement) failure sending router advertisement on nic <%s>: %v", nic, err)
+		}
+	}
+
+	solicitations := make(chan net.IP, 1)
+	go func() {
+		buf := make([]byte, ifi.MTU)
+		for {
+			n, cm, src, err := p.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Warnf("(dhcpv6.runRouterAdvertisement) failure reading nic <%s>: %v", nic, err)
+				}
+				close(solicitations)
+				return
+			}
+			// RFC 4861 6.1.1, only accept valid solicitations of the link
+			if n < 8 || buf[0] != byte(ipv6.ICMPTypeRouterSolicitation) || cm == nil ||
+				cm.IfIndex != ifi.Index || cm.HopLimit != raHopLimit {
+				continue
+			}
+			var srcIP net.IP
+			if addr, ok := src.(*net.IPAddr); ok && !addr.IP.IsUnspecified() {
+				srcIP = addr.IP
+			}
+			select {
+			case solicitations <- srcIP:
+			default:
+			}
+		}
+	}()
+
+	log.Infof("(dhcpv6.runRouterAdvertisement) router advertisement on nic <%s> has started", nic)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			send(allNodes, true)
+			log.Infof("(dhcpv6.runRouterAdvertisement) router advertisement on nic <%s> has stopped", nic)
+			return
+		case src, ok := <-solicitations:
+			if !ok {
+				return
+			}
+			// answer to the soliciting node, or to all nodes if it has no address yet
+			if src == nil {
+				src = allNodes
+			}
+			send(src, false)
+		case <-timer.C:
+			send(allNodes, false)
+			timer.Reset(nextRAInterval(a.RouterAdvertisementSubnets(nic)))
+		}
+	}
+}
+
+// nextRAInterval Returns a random interval between MinRtrAdvInterval (0.33 * MaxRtrAdvInterval) and MaxRtrAdvInterval
+func nextRAInterval(subnets []OVNSubnet) time.Duration {
+	interval := raMaxInterval(subnets)
+	minInterval := interval / 3
+	return minInterval + time.Duration(rand.Int63n(int64(interval-minInterval)+1))
+}
+
+// raMaxInterval Returns the smallest MaxRtrAdvInterval of the subnets
+func raMaxInterval(subnets []OVNSubnet) time.Duration {
+	interval := DefaultRAInterval
+	for _, subnet := range subnets {
+		if subnet.RA.Interval > 0 && subnet.RA.Interval < interval {
+			interval = subnet.RA.Interval
+		}
+	}
+	return interval
+}
+
+// buildRouterAdvertisement Build the ICMPv6 router advertisement (RFC 4861) of the subnets served on the same nic.
+// The flags are merged, prefix information, RDNSS and DNSSL (RFC 8106) are gathered from all subnets
+// and the smallest MTU is advertised. The checksum is computed by the kernel.
+func buildRouterAdvertisement(subnets []OVNSubnet, final bool) []byte {
+	var flags byte
+	var routerLifetime time.Duration
+	var mtu uint32
+	var dns []net.IP
+	var domains []string
+	for _, subnet := range subnets {
+		if subnet.RA.Managed {
+			flags |= 0x80
+		}
+		if subnet.RA.Other {
+			flags |= 0x40
+		}
+		routerLifetime = max(routerLifetime, subnet.RA.RouterLifetime)
+		if subnet.MTU > 0 && (mtu == 0 || subnet.MTU < mtu) {
+			mtu = subnet.MTU
+		}
+		for _, ip := range subnet.DNS {
+			if !slices.ContainsFunc(dns, ip.Equal) {
+				dns = append(dns, ip)
+			}
+		}
+		for _, domain := range subnet.DomainSearch {
+			if !slices.Contains(domains, domain) {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	if final {
+		routerLifetime = 0
+	}
+
+	b := make([]byte, 16)
+	b[0] = byte(ipv6.ICMPTypeRouterAdvertisement)
+	b[4] = 64 // cur hop limit
+	b[5] = flags
+	binary.BigEndian.PutUint16(b[6:8], uint16(min(routerLifetime/time.Second, 9000)))
+
+	// source link-layer address
+	if mac, err := net.ParseMAC(subnets[0].ServerMac); err == nil && len(mac) == 6 {
+		b = append(b, 1, 1)
+		b = append(b, mac...)
+	}
+	if mtu > 0 {
+		b = append(b, 5, 1, 0, 0)
+		b = binary.BigEndian.AppendUint32(b, mtu)
+	}
+	for _, subnet := range subnets {
+		if subnet.CIDR == nil {
+			continue
+		}
+		ones, _ := subnet.CIDR.Mask.Size()
+		prefixFlags := byte(0x80) // on-link
+		if subnet.RA.Autonomous {
+			prefixFlags |= 0x40
+		}
+		// the addresses configured by SLAAC expire like the addresses leased by DHCPv6
+		preferredLifetime, validLifetime := subnet.Lifetimes()
+		if validLifetime <= 0 {
+			preferredLifetime, validLifetime = DefaultPrefixPreferredLifetime, DefaultPrefixValidLifetime
+		}
+		if final {
+			preferredLifetime = 0
+		}
+		b = append(b, 3, 4, byte(ones), prefixFlags)
+		b = binary.BigEndian.AppendUint32(b, uint32(validLifetime/time.Second))
+		b = binary.BigEndian.AppendUint32(b, uint32(preferredLifetime/time.Second))
+		b = append(b, 0, 0, 0, 0)
+		b = append(b, subnet.CIDR.IP.To16()...)
+	}
+
+	// RFC 8106 recommends a lifetime of at least 3 * MaxRtrAdvInterval
+	dnsLifetime := uint32(3 * raMaxInterval(subnets) / time.Second)
+	if len(dns) > 0 {
+		b = append(b, 25, byte(1+2*len(dns)), 0, 0)
+		b = binary.BigEndian.AppendUint32(b, dnsLifetime)
+		for _, ip := range dns {
+			b = append(b, ip.To16()...)
+		}
+	}
+	if len(domains) > 0 {
+		labels := (&rfc1035label.Labels{Labels: domains}).ToBytes()
+		if padding := (8 - (8+len(labels))%8) % 8; padding > 0 {
+			labels = append(labels, make([]byte, padding)...)
+		}
+		b = append(b, 31, byte((8+len(labels))/8), 0, 0)
+		b = binary.BigEndian.AppendUint32(b, dnsLifetime)
+		b = append(b, labels...)
+	}
+	return b
+}
+
+// ValidateRAInterval MaxRtrAdvInterval must be between 4 and 1800 seconds (RFC 4861 6.2.1)
+func ValidateRAInterval(interval time.Duration) error {
+	if interval < 4*time.Second || interval > 1800*time.Second {
+		return fmt.Errorf("router advertisement interval <%s> must be between 4s and 1800s", interval)
+	}
+	return nil
+}
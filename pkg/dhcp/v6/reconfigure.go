@@ -0,0 +1,102 @@
+package v6
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	log "github.com/sirupsen/logrus"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// ErrReconfigureNotAccepted the client did not send a Reconfigure Accept option, it would drop a Reconfigure
+var ErrReconfigureNotAccepted = errors.New("reconfigure not accepted by the client")
+
+// reconfigureKey the reconfigure key sent to the client in the last Reply,
+// with the client DUID and the way back to the client
+type reconfigureKey struct {
+	key      []byte
+	clientID dhcpv6.DUID
+	conn     net.PacketConn
+	peer     net.Addr
+	relay    *dhcpv6.RelayMessage // Relay-Forward of the request, nil if the client is on link
+}
+
+// setReconfigureKey RFC 8415 20.4.2: a client that sent a Reconfigure Accept option receives a new reconfigure key
+// in each Reply, the key is kept in memory only, the guest negotiates a new one on its next renewal
+func (a *DHCPAllocator) setReconfigureKey(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6, msg, resp *dhcpv6.Message, hwaddr net.HardwareAddr) {
+	if msg.GetOneOption(dhcpv6.OptionReconfAccept) == nil || msg.Options.ClientID() == nil || hwaddr == nil {
+		return
+	}
+	resp.AddOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionReconfAccept})
+	if resp.MessageType != dhcpv6.MessageTypeReply {
+		return
+	}
+	key, err := dhcp.NewReconfigureKey()
+	if err != nil {
+		log.Errorf("(dhcpv6.setReconfigureKey) hwaddr [%s]: %v", hwaddr.String(), err)
+		return
+	}
+	resp.AddOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionAuth, OptionData: dhcp.ReconfigureKeyAuth(key)})
+
+	rk := reconfigureKey{key: key, clientID: msg.Options.ClientID(), conn: conn, peer: peer}
+	if m.IsRelay() {
+		rk.relay = m.(*dhcpv6.RelayMessage)
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.reconfigureKeys[hwaddr.String()] = rk
+}
+
+// Reconfigure Send a Reconfigure to the guest holding the lease of hwAddr, so that it renews the lease,
+// or sends an Information-Request on a stateless subnet, and picks up the changed options immediately
+func (a *DHCPAllocator) Reconfigure(hwAddr string) error {
+	a.mutex.RLock()
+	lease, hasLease := a.leases[hwAddr]
+	subnet, hasSubnet := a.subnets[lease.SubnetKey]
+	rk, hasKey := a.reconfigureKeys[hwAddr]
+	a.mutex.RUnlock()
+
+	if !hasLease || !hasSubnet {
+		return fmt.Errorf("no lease found for hardware address <%s>", hwAddr)
+	}
+	if !hasKey {
+		return ErrReconfigureNotAccepted
+	}
+
+	msg, auth := newReconfigure(rk.clientID, subnet)
+	if err := dhcp.SignReconfigure(msg.ToBytes(), auth, rk.key); err != nil {
+		return err
+	}
+
+	var out dhcpv6.DHCPv6 = msg
+	if rk.relay != nil {
+		var err error
+		if out, err = dhcpv6.NewRelayReplFromRelayForw(rk.relay, msg); err != nil {
+			return fmt.Errorf("cannot build relay reply: %v", err)
+		}
+	}
+	if _, err := rk.conn.WriteTo(out.ToBytes(), rk.peer); err != nil {
+		return fmt.Errorf("cannot send Reconfigure to <%s>: %v", rk.peer.String(), err)
+	}
+	log.Infof("(dhcpv6.Reconfigure) Reconfigure sent to hwaddr [%s] peer <%s>", hwAddr, rk.peer.String())
+	return nil
+}
+
+// newReconfigure Returns the Reconfigure (RFC 8415 16.11) signed in place by dhcp.SignReconfigure
+// through the returned authentication option value
+func newReconfigure(clientID dhcpv6.DUID, subnet OVNSubnet) (*dhcpv6.Message, []byte) {
+	msgType := dhcpv6.MessageTypeRenew
+	if subnet.Stateless {
+		msgType = dhcpv6.MessageTypeInformationRequest
+	}
+	auth := dhcp.ReconfigureHMACAuth()
+	// the transaction id of a Reconfigure is zero
+	msg := &dhcpv6.Message{MessageType: dhcpv6.MessageTypeReconfigure}
+	msg.AddOption(dhcpv6.OptServerID(serverDUID(subnet)))
+	msg.AddOption(dhcpv6.OptClientID(clientID))
+	msg.AddOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionReconfMessage, OptionData: []byte{byte(msgType)}})
+	msg.AddOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionAuth, OptionData: auth})
+	return msg, auth
+}
@@ -0,0 +1,84 @@
+package v6
+
+import (
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+)
+
+// SetLeaseNotify Notify the pod controller after the state of a lease changed
+func (a *DHCPAllocator) SetLeaseNotify(notify dhcp.LeaseNotify) {
+	a.mutex.Lock()
+	a.notify = notify
+	a.mutex.Unlock()
+}
+
+// updateLeaseStatus Record a transaction of the client in the status of its lease,
+// a Solicit answered by a rapid commit Reply binds the lease for the valid lifetime
+func (a *DHCPAllocator) updateLeaseStatus(hwAddr string, msg, resp *dhcpv6.Message, validLifetime time.Duration) {
+	now := time.Now()
+	a.mutex.Lock()
+	lease, ok := a.leases[hwAddr]
+	if !ok {
+		a.mutex.Unlock()
+		return
+	}
+	previous := lease.Status
+	switch msg.MessageType { //nolint:exhaustive
+	case dhcpv6.MessageTypeSolicit:
+		lease.Status.Offer(now)
+		if resp.MessageType == dhcpv6.MessageTypeReply {
+			lease.Status.Bind(now, validLifetime)
+		}
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRebind:
+		lease.Status.Bind(now, validLifetime)
+	case dhcpv6.MessageTypeRelease:
+		lease.Status.Release(dhcp.LeaseStateReleased)
+	case dhcpv6.MessageTypeDecline:
+		lease.Status.Release(dhcp.LeaseStateDeclined)
+	default:
+		a.mutex.Unlock()
+		return
+	}
+	lease.Status.SetClient(clientHostname(msg), clientVendorClass(msg))
+	a.leases[hwAddr] = lease
+	changed := lease.Status.StateChanged(previous, now)
+	notify, podKeys := a.notify, a.macPodKeys[hwAddr].List()
+	a.mutex.Unlock()
+
+	if changed && lease.Status.State.Persistent() {
+		a.persistLeases(hwAddr)
+	}
+	// the DHCPLease keeps the state, a renewal only moves the expiry time
+	if notify == nil || !changed {
+		return
+	}
+	for _, podKey := range podKeys {
+		notify.NotifyLease(podKey)
+	}
+}
+
+// clientHostname host part of the client FQDN option
+func clientHostname(msg *dhcpv6.Message) string {
+	fqdn := msg.Options.FQDN()
+	if fqdn == nil || fqdn.DomainName == nil || len(fqdn.DomainName.Labels) == 0 {
+		return ""
+	}
+	hostname, _, _ := strings.Cut(fqdn.DomainName.Labels[0], ".")
+	return hostname
+}
+
+// clientVendorClass data of the first vendor class option
+func clientVendorClass(msg *dhcpv6.Message) string {
+	classes := msg.Options.VendorClasses()
+	if len(classes) == 0 {
+		return ""
+	}
+	data := make([]string, 0, len(classes[0].Data))
+	for _, d := range classes[0].Data {
+		data = append(data, string(d))
+	}
+	return strings.Join(data, ",")
+}
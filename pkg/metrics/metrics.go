@@ -7,6 +7,7 @@ import (
 	"os"
 	"slices"
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -29,6 +30,16 @@ type MetricsAllocator struct {
 	dcloud_vm_dhcp_v4_lease_time *prometheus.GaugeVec
 	// vm dhcp v6 lease time
 	dcloud_vm_dhcp_v6_lease_time *prometheus.GaugeVec
+	// vm dhcp v6 delegated prefix lease time
+	dcloud_vm_dhcp_v6_delegated_prefix *prometheus.GaugeVec
+
+	// vm dhcp v4 decline count
+	dcloud_vm_dhcp_v4_decline_total *prometheus.CounterVec
+
+	// vm dhcp lease lifecycle state
+	dcloud_vm_dhcp_lease_state *prometheus.GaugeVec
+	// vm dhcp lease expiry time
+	dcloud_vm_dhcp_lease_expiry_time *prometheus.GaugeVec
 
 	registry *prometheus.Registry
 }
@@ -70,6 +81,34 @@ func NewMetricsAllocator() *MetricsAllocator {
 			},
 			[]string{"vm", "subnet", "ip", "mac"},
 		),
+		dcloud_vm_dhcp_v6_delegated_prefix: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dcloud_vm_dhcp_v6_delegated_prefix",
+				Help: "DCloud virtual machine DHCPv6 delegated prefix lease time (second)",
+			},
+			[]string{"vm", "subnet", "prefix", "mac"},
+		),
+		dcloud_vm_dhcp_v4_decline_total: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dcloud_vm_dhcp_v4_decline_total",
+				Help: "DCloud virtual machine DHCPv4 DECLINE messages received",
+			},
+			[]string{"vm", "subnet", "ip", "mac"},
+		),
+		dcloud_vm_dhcp_lease_state: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dcloud_vm_dhcp_lease_state",
+				Help: "DCloud virtual machine DHCP lease state (Allocated, Offered, Bound, Renewed, Expired, Released, Declined)",
+			},
+			[]string{"vm", "subnet", "protocol", "ip", "mac", "state"},
+		),
+		dcloud_vm_dhcp_lease_expiry_time: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dcloud_vm_dhcp_lease_expiry_time",
+				Help: "DCloud virtual machine DHCP lease expiry time (unix timestamp in seconds)",
+			},
+			[]string{"vm", "subnet", "protocol", "ip", "mac"},
+		),
 	}
 
 	m.registry = prometheus.NewRegistry()
@@ -78,6 +117,10 @@ func NewMetricsAllocator() *MetricsAllocator {
 	m.registry.MustRegister(m.dcloud_dhcp_subnet_info)
 	m.registry.MustRegister(m.dcloud_vm_dhcp_v4_lease_time)
 	m.registry.MustRegister(m.dcloud_vm_dhcp_v6_lease_time)
+	m.registry.MustRegister(m.dcloud_vm_dhcp_v6_delegated_prefix)
+	m.registry.MustRegister(m.dcloud_vm_dhcp_v4_decline_total)
+	m.registry.MustRegister(m.dcloud_vm_dhcp_lease_state)
+	m.registry.MustRegister(m.dcloud_vm_dhcp_lease_expiry_time)
 	return m
 }
 
@@ -126,6 +169,14 @@ func (m *MetricsAllocator) DeletePartialVMDHCPv4Lease(vmKey string, reservedMacs
 	m.deletePartialVMDHCPLease("dcloud_vm_dhcp_v4_lease_time", vmKey, reservedMacs, m.DeleteVMDHCPv4Lease)
 }
 
+func (m *MetricsAllocator) IncVMDHCPv4Decline(vmKey, subnetName, ip, mac string) {
+	m.dcloud_vm_dhcp_v4_decline_total.WithLabelValues(vmKey, subnetName, ip, mac).Inc()
+}
+
+func (m *MetricsAllocator) DeleteVMDHCPv4Decline(vmKey string) {
+	m.dcloud_vm_dhcp_v4_decline_total.DeletePartialMatch(prometheus.Labels{"vm": vmKey})
+}
+
 func (m *MetricsAllocator) UpdateVMDHCPv6Lease(vmKey, subnetName, ip, mac string, lease int) {
 	m.DeleteVMDHCPv6Lease(vmKey, mac)
 	m.dcloud_vm_dhcp_v6_lease_time.WithLabelValues(vmKey, subnetName, ip, mac).Set(float64(lease))
@@ -137,12 +188,41 @@ func (m *MetricsAllocator) DeleteVMDHCPv6Lease(vmKey string, mac string) {
 	} else {
 		m.dcloud_vm_dhcp_v6_lease_time.DeletePartialMatch(prometheus.Labels{"vm": vmKey, "mac": mac})
 	}
+	m.DeleteVMDHCPv6DelegatedPrefix(vmKey, mac)
+}
+
+func (m *MetricsAllocator) UpdateVMDHCPv6DelegatedPrefix(vmKey, subnetName, prefix, mac string, lease int) {
+	m.DeleteVMDHCPv6DelegatedPrefix(vmKey, mac)
+	m.dcloud_vm_dhcp_v6_delegated_prefix.WithLabelValues(vmKey, subnetName, prefix, mac).Set(float64(lease))
+}
+
+func (m *MetricsAllocator) DeleteVMDHCPv6DelegatedPrefix(vmKey string, mac string) {
+	if mac == "" {
+		m.dcloud_vm_dhcp_v6_delegated_prefix.DeletePartialMatch(prometheus.Labels{"vm": vmKey})
+	} else {
+		m.dcloud_vm_dhcp_v6_delegated_prefix.DeletePartialMatch(prometheus.Labels{"vm": vmKey, "mac": mac})
+	}
 }
 
 func (m *MetricsAllocator) DeletePartialVMDHCPv6Lease(vmKey string, reservedMacs []string) {
 	m.deletePartialVMDHCPLease("dcloud_vm_dhcp_v6_lease_time", vmKey, reservedMacs, m.DeleteVMDHCPv6Lease)
 }
 
+// UpdateVMDHCPLeaseState expiry is zero until the lease is bound
+func (m *MetricsAllocator) UpdateVMDHCPLeaseState(vmKey, subnetName, protocol, ip, mac, state string, expiry time.Time) {
+	m.DeleteVMDHCPLeaseState(vmKey, protocol, mac)
+	m.dcloud_vm_dhcp_lease_state.WithLabelValues(vmKey, subnetName, protocol, ip, mac, state).Set(float64(1))
+	if !expiry.IsZero() {
+		m.dcloud_vm_dhcp_lease_expiry_time.WithLabelValues(vmKey, subnetName, protocol, ip, mac).Set(float64(expiry.Unix()))
+	}
+}
+
+func (m *MetricsAllocator) DeleteVMDHCPLeaseState(vmKey, protocol, mac string) {
+	labels := prometheus.Labels{"vm": vmKey, "protocol": protocol, "mac": mac}
+	m.dcloud_vm_dhcp_lease_state.DeletePartialMatch(labels)
+	m.dcloud_vm_dhcp_lease_expiry_time.DeletePartialMatch(labels)
+}
+
 func (m *MetricsAllocator) deletePartialVMDHCPLease(gaugeName, vmKey string, reservedMacs []string, deleteFunc func(string, string)) {
 	// gather all metrics so we make sure we delete all of them
 	mfs, err := prometheus.Gatherer(m.registry).Gather()
@@ -177,6 +257,11 @@ func (m *MetricsAllocator) deletePartialVMDHCPLease(gaugeName, vmKey string, res
 	}
 }
 
+// Gather Returns the current values of the metrics, as served on the metrics port
+func (m *MetricsAllocator) Gather() ([]*dto.MetricFamily, error) {
+	return m.registry.Gather()
+}
+
 func (m *MetricsAllocator) Run(ctx context.Context) {
 	log.Infof("(metrics.Run) starting Metrics service")
 
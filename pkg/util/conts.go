@@ -13,6 +13,23 @@ const (
 	// AnnoDCloudMappingProvider Applied to Service annotations,
 	// Specify the mapping provider for LoadBalancer type Service.
 	AnnoDCloudMappingProvider = networkPrefix + "/mapping-provider"
+	// AnnoDCloudDHCPHostname Applied to Subnet annotations,
+	// Send the virtual machine name as the DHCP hostname when the value is "true".
+	AnnoDCloudDHCPHostname = networkPrefix + "/dhcp-hostname"
+	// AnnoDCloudDHCPFQDNTemplate Applied to Subnet annotations,
+	// Go template of the client FQDN, example: {{.VM}}.{{.Namespace}}.vm.example.com
+	AnnoDCloudDHCPFQDNTemplate = networkPrefix + "/dhcp-fqdn-template"
+	// AnnoDCloudDHCPClientClasses Applied to Subnet annotations,
+	// JSON list of the DHCPv4 client classes, the first class matched by the client overrides the subnet options,
+	// example: [{"name":"pxe","vendorClass":"PXEClient","options":{"option_60":"string:PXEClient"},"vendorOptions":{"6":"uint8:8"}}]
+	AnnoDCloudDHCPClientClasses = networkPrefix + "/dhcp-client-classes"
+	// AnnoDCloudDHCPStatus Applied to Pod annotations by the controller,
+	// JSON list of the DHCP bindings of the virtual machine interfaces, example:
+	// [{"interface":"net1","network":"default/vlan10","mac":"52:54:00:a1:b2:c3","protocol":"DHCPv4","ip":"10.0.0.5","state":"Bound","boundTime":"2024-06-01T12:00:00Z"}]
+	AnnoDCloudDHCPStatus = networkPrefix + "/dhcp-status"
+	// AnnoDCloudDelegatedPrefixTemplate Applied to Pod annotations, <multus name>.<multus namespace>.network.dcloud.tydic.io/delegated-prefix
+	// Specify the IPv6 prefix delegated to the virtual machine by DHCPv6 IA_PD, example: 2001:db8:100:1::/64
+	AnnoDCloudDelegatedPrefixTemplate = "%s.%s." + networkPrefix + "/delegated-prefix"
 
 	//AnnoDCloudEnableDHCP = networkPrefix + "/enable-dhcp" // true
 )
@@ -1,23 +1,40 @@
 package util
 
 import (
+	"cmp"
+	"encoding/hex"
 	"fmt"
 	"net"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
 	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	kubeovnv1 "github.com/kubeovn/kube-ovn/pkg/apis/kubeovn/v1"
 	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/json"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
 	"tydic.io/dcloud-dhcp-controller/pkg/dhcp/v4"
 	v6 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v6"
 )
 
 // BuildOVNSubnetByIPV4Options
-// parameters: lease_time \ router \ ntp_server \ dns_server
+// parameters: lease_time \ renewal_time \ rebinding_time \ router \ ntp_server \ dns_server \ authoritative \ domain_name \ domain_search \
+// classless_static_route \ next_server \ tftp_server_name \ boot_file \ boot_file_bios \ boot_file_efi64 \
+// boot_file_arm64 \ boot_file_ipxe \ http_boot_url \ option_<code> \ plugins
 // example :
 //
-//	dhcpOptions: "lease_time=3600,router={192.168.1.1;192.168.2.1},ntp_server=10.20.10.19,dns_server={8.8.8.8;8.8.4.4}"
+//	dhcpOptions: "lease_time=3600,router={192.168.1.1;192.168.2.1},ntp_server=10.20.10.19,dns_server={8.8.8.8;8.8.4.4},authoritative=true"
+//	dhcpOptions: "domain_name=vm.example.com,domain_search={vm.example.com;example.com}"
+//	dhcpOptions: "classless_static_route={10.0.0.0/8,10.1.1.1;172.16.0.0/12,10.1.1.2}"
+//	dhcpOptions: "next_server=192.168.1.10,boot_file_bios=undionly.kpxe,boot_file_efi64=ipxe.efi,boot_file_ipxe=http://192.168.1.10/boot.ipxe"
+//	dhcpOptions: "option_7={ips:10.0.0.5;10.0.0.6},option_2=int32:-3600,option_43=hex:01:04:c0:a8:00:01"
+//	dhcpOptions: "plugins={-netboot;-hostname}" or "plugins={dns;routes;raw_options}"
 func BuildOVNSubnetByIPV4Options(
 	subnet *kubeovnv1.Subnet,
 	networkStatus networkv1.NetworkStatus,
@@ -45,6 +62,10 @@ func BuildOVNSubnetByIPV4Options(
 		leaseTime = 3600
 	}
 	ovnSubnet.LeaseTime = leaseTime
+	ovnSubnet.RenewalTime, ovnSubnet.RebindingTime, err = parseRenewalTimes(dhcpv4OptionsMap, leaseTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option: %v", err)
+	}
 	var routers []net.IP
 	for _, ipstr := range strings.Split(dhcpv4OptionsMap["router"], ",") {
 		if ipstr == "" {
@@ -86,11 +107,12 @@ func BuildOVNSubnetByIPV4Options(
 	var subnetMask net.IPMask
 	ipv4Cidr := strings.Split(subnet.Spec.CIDRBlock, ",")[0]
 	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(ipv4Cidr))
-	if err != nil {
+	if err != nil || ipNet.IP.To4() == nil {
 		// 默认24
 		subnetMask = net.CIDRMask(24, 32)
 	} else {
 		subnetMask = ipNet.Mask
+		ovnSubnet.CIDR = ipNet
 	}
 	ovnSubnet.SubnetMask = subnetMask
 
@@ -104,12 +126,268 @@ func BuildOVNSubnetByIPV4Options(
 		}
 	}
 	ovnSubnet.DNS = dns
+	if ovnSubnet.Authoritative, err = parseBoolOption(dhcpv4OptionsMap, "authoritative", false); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option: %v", err)
+	}
+
+	if domainName := dhcpv4OptionsMap["domain_name"]; domainName != "" {
+		name, err := NormalizeDomainName(domainName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DHCPv4 option domain_name <%s>: %v", domainName, err)
+		}
+		ovnSubnet.DomainName = name
+	}
+	domainSearch, err := parseDomainList(dhcpv4OptionsMap["domain_search"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option domain_search: %v", err)
+	}
+	ovnSubnet.DomainSearch = domainSearch
+
+	routes, err := parseClasslessStaticRoutes(dhcpv4OptionsMap["classless_static_route"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option classless_static_route: %v", err)
+	}
+	// RFC 3442: clients ignore the router option when option 121 is present,
+	// so the default route has to be carried in the classless static routes
+	if len(routes) > 0 && len(routers) > 0 && !slices.ContainsFunc(routes, isDefaultRoute) {
+		routes = append(routes, &dhcpv4.Route{
+			Dest:   &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+			Router: routers[0].To4(),
+		})
+	}
+	ovnSubnet.ClasslessStaticRoutes = routes
+
+	ovnSubnet.Hostname, ovnSubnet.FQDNTemplate, err = GetDHCPHostnameOptions(subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	netBoot, err := buildNetBoot(dhcpv4OptionsMap)
+	if err != nil {
+		return nil, err
+	}
+	ovnSubnet.NetBoot = netBoot
+
+	if ovnSubnet.RawOptions, err = dhcp.ParseRawOptions(dhcpv4OptionsMap, false); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option: %v", err)
+	}
+	if ovnSubnet.ClientClasses, err = GetDHCPClientClasses(subnet); err != nil {
+		return nil, err
+	}
+	ovnSubnet.Plugins = dhcp.ParsePluginNames(dhcpv4OptionsMap["plugins"])
+	if ovnSubnet.Chain, err = v4.Plugins.Chain(ovnSubnet.Plugins); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option plugins: %v", err)
+	}
+	if ovnSubnet.RateLimit, ovnSubnet.RateLimitBurst, err = parseRateLimit(dhcpv4OptionsMap); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv4 option: %v", err)
+	}
+	if ovnSubnet.RateLimit > 0 {
+		ovnSubnet.RateLimiter = dhcp.NewRateLimiter(ovnSubnet.RateLimit, ovnSubnet.RateLimitBurst)
+	} else if slices.Contains(ovnSubnet.Plugins, "ratelimit") {
+		return nil, fmt.Errorf("invalid DHCPv4 option plugins: the ratelimit plugin requires the rate_limit option")
+	}
 	return ovnSubnet, nil
 }
 
+// clientClassSpec client class in the Subnet annotation
+type clientClassSpec struct {
+	Name        string `json:"name"`
+	VendorClass string `json:"vendorClass,omitempty"` // prefix of option 60
+	UserClass   string `json:"userClass,omitempty"`   // one of the option 77 user classes
+	MACPrefix   string `json:"macPrefix,omitempty"`   // example: 52:54:00
+	// Options option_<code> -> <type>:<value>, same syntax as the raw options of DHCPv4Options
+	Options map[string]string `json:"options,omitempty"`
+	// VendorOptions option 43 sub-options, code -> <type>:<value>
+	VendorOptions map[string]string `json:"vendorOptions,omitempty"`
+}
+
+// GetDHCPClientClasses Parse the client classes annotation of the subnet
+func GetDHCPClientClasses(subnet *kubeovnv1.Subnet) ([]v4.ClientClass, error) {
+	value := strings.TrimSpace(subnet.GetAnnotations()[AnnoDCloudDHCPClientClasses])
+	if value == "" {
+		return nil, nil
+	}
+	var specs []clientClassSpec
+	if err := json.Unmarshal([]byte(value), &specs); err != nil {
+		return nil, fmt.Errorf("invalid annotation '%s': %v", AnnoDCloudDHCPClientClasses, err)
+	}
+	classes := make([]v4.ClientClass, 0, len(specs))
+	for i, spec := range specs {
+		class, err := parseClientClass(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation '%s' class %d <%s>: %v", AnnoDCloudDHCPClientClasses, i, spec.Name, err)
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+func parseClientClass(spec clientClassSpec) (v4.ClientClass, error) {
+	class := v4.ClientClass{
+		Name:        spec.Name,
+		VendorClass: spec.VendorClass,
+		UserClass:   spec.UserClass,
+	}
+	if spec.Name == "" {
+		return class, fmt.Errorf("name is required")
+	}
+	if spec.MACPrefix != "" {
+		prefix, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(spec.MACPrefix))
+		if err != nil || len(prefix) == 0 || len(prefix) > 6 {
+			return class, fmt.Errorf("invalid macPrefix <%s>", spec.MACPrefix)
+		}
+		class.MACPrefix = prefix
+	}
+	if class.VendorClass == "" && class.UserClass == "" && len(class.MACPrefix) == 0 {
+		return class, fmt.Errorf("at least one of vendorClass, userClass or macPrefix is required")
+	}
+
+	for key := range spec.Options {
+		if !strings.HasPrefix(key, dhcp.RawOptionPrefix) {
+			return class, fmt.Errorf("option <%s> must be %s<code>", key, dhcp.RawOptionPrefix)
+		}
+	}
+	options, err := dhcp.ParseRawOptions(spec.Options, false)
+	if err != nil {
+		return class, err
+	}
+	class.RawOptions = options
+
+	// option 43 is a sequence of code, length, value sub-options
+	var subOptions []dhcp.RawOption
+	for codeStr, value := range spec.VendorOptions {
+		code, err := strconv.ParseUint(codeStr, 10, 8)
+		if err != nil || code == 0 || code == 255 {
+			return class, fmt.Errorf("vendor option code <%s> must be between 1 and 254", codeStr)
+		}
+		b, err := dhcp.ParseRawValue(value, false)
+		if err != nil {
+			return class, fmt.Errorf("invalid vendor option <%s>: %v", codeStr, err)
+		}
+		subOptions = append(subOptions, dhcp.RawOption{Code: uint16(code), Value: b})
+	}
+	slices.SortFunc(subOptions, func(a, b dhcp.RawOption) int { return cmp.Compare(a.Code, b.Code) })
+	for _, subOption := range subOptions {
+		class.VendorInfo = append(class.VendorInfo, byte(subOption.Code), byte(len(subOption.Value)))
+		class.VendorInfo = append(class.VendorInfo, subOption.Value...)
+	}
+	if len(class.VendorInfo) > 255 {
+		return class, fmt.Errorf("vendor options are longer than 255 bytes")
+	}
+	return class, nil
+}
+
+// netBootArchOptions Boot file options by client system architecture (RFC 4578 option 93)
+var netBootArchOptions = map[string][]iana.Arch{
+	"boot_file_bios":  {iana.INTEL_X86PC},
+	"boot_file_efi64": {iana.EFI_X86_64, iana.EFI_BC},
+	"boot_file_arm64": {iana.EFI_ARM64},
+}
+
+func buildNetBoot(dhcpv4OptionsMap map[string]string) (v4.NetBoot, error) {
+	netBoot := v4.NetBoot{
+		TFTPServerName: dhcpv4OptionsMap["tftp_server_name"],
+		BootFile:       dhcpv4OptionsMap["boot_file"],
+		IPXEBootFile:   dhcpv4OptionsMap["boot_file_ipxe"],
+		HTTPBootURL:    dhcpv4OptionsMap["http_boot_url"],
+	}
+	if netBoot.HTTPBootURL != "" {
+		if err := validateBootURL(netBoot.HTTPBootURL); err != nil {
+			return netBoot, fmt.Errorf("invalid DHCPv4 option http_boot_url: %v", err)
+		}
+	}
+	if nextServer := dhcpv4OptionsMap["next_server"]; nextServer != "" {
+		if !IsIPv4(nextServer) {
+			return netBoot, fmt.Errorf("invalid DHCPv4 option next_server <%s>", nextServer)
+		}
+		netBoot.NextServer = net.ParseIP(nextServer).To4()
+	}
+	for key, archs := range netBootArchOptions {
+		bootFile := dhcpv4OptionsMap[key]
+		if bootFile == "" {
+			continue
+		}
+		if netBoot.ArchBootFiles == nil {
+			netBoot.ArchBootFiles = make(map[iana.Arch]string)
+		}
+		for _, arch := range archs {
+			netBoot.ArchBootFiles[arch] = bootFile
+		}
+	}
+	if len(netBoot.TFTPServerName) > 63 {
+		return netBoot, fmt.Errorf("DHCPv4 option tftp_server_name is longer than 63 characters")
+	}
+	return netBoot, nil
+}
+
+func validateBootURL(bootURL string) error {
+	u, err := url.Parse(bootURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("<%s> is not an absolute url", bootURL)
+	}
+	return nil
+}
+
+// GetDHCPHostnameOptions Returns the hostname toggle and the FQDN template of the subnet annotations
+func GetDHCPHostnameOptions(subnet *kubeovnv1.Subnet) (bool, string, error) {
+	annotations := subnet.GetAnnotations()
+	enable, _ := strconv.ParseBool(annotations[AnnoDCloudDHCPHostname])
+	fqdnTemplate := strings.TrimSpace(annotations[AnnoDCloudDHCPFQDNTemplate])
+	if fqdnTemplate != "" {
+		if _, err := dhcp.ParseFQDNTemplate(fqdnTemplate); err != nil {
+			return false, "", fmt.Errorf("invalid annotation '%s': %v", AnnoDCloudDHCPFQDNTemplate, err)
+		}
+	}
+	return enable, fqdnTemplate, nil
+}
+
+func isDefaultRoute(route *dhcpv4.Route) bool {
+	ones, _ := route.Dest.Mask.Size()
+	return ones == 0
+}
+
+// parseClasslessStaticRoutes parse the `destination,router` pairs of the classless static route option
+func parseClasslessStaticRoutes(value string) ([]*dhcpv4.Route, error) {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items)%2 != 0 {
+		return nil, fmt.Errorf("expected pairs of destination and router, got <%s>", value)
+	}
+	var routes []*dhcpv4.Route
+	for i := 0; i < len(items); i += 2 {
+		_, dest, err := net.ParseCIDR(items[i])
+		if err != nil || dest.IP.To4() == nil {
+			return nil, fmt.Errorf("destination <%s> is not a valid IPv4 CIDR", items[i])
+		}
+		if !IsIPv4(items[i+1]) {
+			return nil, fmt.Errorf("router <%s> is not a valid IPv4 address", items[i+1])
+		}
+		routes = append(routes, &dhcpv4.Route{
+			Dest:   &net.IPNet{IP: dest.IP.To4(), Mask: dest.Mask},
+			Router: net.ParseIP(items[i+1]).To4(),
+		})
+	}
+	return routes, nil
+}
+
 // BuildOVNSubnetByIPV6Options
-// parameters: lease_time \ ntp_server \ dns_server
+// parameters: lease_time \ preferred_lifetime \ valid_lifetime \ renewal_time \ rebinding_time \
+// ntp_server \ dns_server \ boot_file_url \ boot_file_param \
+// delegated_prefix_pool \ delegated_prefix_len \ mtu \ domain_search \ stateless \ ra \ ra_managed \ ra_other \
+// ra_autonomous \ ra_interval \ ra_router_lifetime \ option_<code> \ plugins
+// example :
+//
+//	dhcpOptions: "boot_file_url=http://[2001:db8::10]/boot.efi,boot_file_param={console=ttyS0;quiet}"
+//	dhcpOptions: "option_22={ips:2001:db8::53;2001:db8::54},option_65001=string:rack1"
 func BuildOVNSubnetByIPV6Options(
+	subnet *kubeovnv1.Subnet,
 	networkStatus networkv1.NetworkStatus,
 	dhcpv6OptionsMap map[string]string) (*v6.OVNSubnet, error) {
 
@@ -124,31 +402,43 @@ func BuildOVNSubnetByIPV6Options(
 		return nil, fmt.Errorf("unable to find multus network <%s> interface <%s> IPv6 address", networkStatus.Name, networkStatus.Interface)
 	}
 	ovnSubnet.ServerIP = serverIP
+	ovnSubnet.CIDR = GetIPV6CIDR(subnet.Spec.CIDRBlock)
 
 	leaseTime, err := strconv.Atoi(dhcpv6OptionsMap["lease_time"])
 	if err != nil || leaseTime <= 0 {
 		leaseTime = 3600
 	}
 	ovnSubnet.LeaseTime = leaseTime
-	var ntp []net.IP
+	ovnSubnet.ValidLifetime, err = parseSeconds(dhcpv6OptionsMap, "valid_lifetime", leaseTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option: %v", err)
+	}
+	ovnSubnet.PreferredLifetime, err = parseSeconds(dhcpv6OptionsMap, "preferred_lifetime", ovnSubnet.ValidLifetime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option: %v", err)
+	}
+	if ovnSubnet.PreferredLifetime > ovnSubnet.ValidLifetime {
+		return nil, fmt.Errorf("invalid DHCPv6 option: preferred_lifetime <%d> is greater than valid_lifetime <%d>",
+			ovnSubnet.PreferredLifetime, ovnSubnet.ValidLifetime)
+	}
+	ovnSubnet.RenewalTime, ovnSubnet.RebindingTime, err = parseRenewalTimes(dhcpv6OptionsMap, ovnSubnet.PreferredLifetime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option: %v", err)
+	}
 	for _, ipstr := range strings.Split(dhcpv6OptionsMap["ntp_server"], ",") {
-		if ipstr == "" {
+		if ipstr == "" || IsIPv4(ipstr) {
 			continue
 		}
 		if IsIPv6(ipstr) {
-			ntp = append(ntp, net.ParseIP(ipstr))
+			ovnSubnet.NTP = append(ovnSubnet.NTP, net.ParseIP(ipstr))
 			continue
 		}
-		// If NTP is a domain name, convert it to IP from the local network
-		hostIPs, err := net.LookupIP(ipstr)
+		// If NTP is a domain name, the client resolves it from the FQDN suboption
+		name, err := NormalizeDomainName(ipstr)
 		if err != nil {
-			log.Debugf("cannot get any ip addresses from ntp domainname entry <%s>: %s", ipstr, err)
-		}
-		for _, ip := range hostIPs {
-			if ip != nil && ip.To16() != nil {
-				ntp = append(ntp, ip)
-			}
+			return nil, fmt.Errorf("invalid DHCPv6 option ntp_server <%s>: %v", ipstr, err)
 		}
+		ovnSubnet.NTPFQDN = append(ovnSubnet.NTPFQDN, name)
 	}
 
 	var dns []net.IP
@@ -161,9 +451,247 @@ func BuildOVNSubnetByIPV6Options(
 		}
 	}
 	ovnSubnet.DNS = dns
+
+	ovnSubnet.Hostname, ovnSubnet.FQDNTemplate, err = GetDHCPHostnameOptions(subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	if bootFileURL := dhcpv6OptionsMap["boot_file_url"]; bootFileURL != "" {
+		if err := validateBootURL(bootFileURL); err != nil {
+			return nil, fmt.Errorf("invalid DHCPv6 option boot_file_url: %v", err)
+		}
+		ovnSubnet.BootFileURL = bootFileURL
+	}
+	for _, param := range strings.Split(dhcpv6OptionsMap["boot_file_param"], ",") {
+		if param != "" {
+			ovnSubnet.BootFileParams = append(ovnSubnet.BootFileParams, param)
+		}
+	}
+
+	ovnSubnet.DelegatedPrefixPool, ovnSubnet.DelegatedPrefixLen, err = parseDelegatedPrefixPool(dhcpv6OptionsMap)
+	if err != nil {
+		return nil, err
+	}
+
+	ovnSubnet.Interface = networkStatus.Interface
+	ovnSubnet.MTU = subnet.Spec.Mtu
+	if value, ok := dhcpv6OptionsMap["mtu"]; ok {
+		mtu, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || mtu < 1280 {
+			return nil, fmt.Errorf("invalid DHCPv6 option mtu <%s>: must be at least 1280", value)
+		}
+		ovnSubnet.MTU = uint32(mtu)
+	}
+	if ovnSubnet.DomainSearch, err = parseDomainList(dhcpv6OptionsMap["domain_search"]); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option domain_search: %v", err)
+	}
+	if ovnSubnet.Stateless, err = parseBoolOption(dhcpv6OptionsMap, "stateless", false); err != nil {
+		return nil, err
+	}
+	if ovnSubnet.RA, err = parseRouterAdvertisement(dhcpv6OptionsMap, ovnSubnet.Stateless); err != nil {
+		return nil, err
+	}
+	if ovnSubnet.RawOptions, err = dhcp.ParseRawOptions(dhcpv6OptionsMap, true); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option: %v", err)
+	}
+	ovnSubnet.Plugins = dhcp.ParsePluginNames(dhcpv6OptionsMap["plugins"])
+	if ovnSubnet.Chain, err = v6.Plugins.Chain(ovnSubnet.Plugins); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option plugins: %v", err)
+	}
+	if ovnSubnet.RateLimit, ovnSubnet.RateLimitBurst, err = parseRateLimit(dhcpv6OptionsMap); err != nil {
+		return nil, fmt.Errorf("invalid DHCPv6 option: %v", err)
+	}
+	if ovnSubnet.RateLimit > 0 {
+		ovnSubnet.RateLimiter = dhcp.NewRateLimiter(ovnSubnet.RateLimit, ovnSubnet.RateLimitBurst)
+	} else if slices.Contains(ovnSubnet.Plugins, "ratelimit") {
+		return nil, fmt.Errorf("invalid DHCPv6 option plugins: the ratelimit plugin requires the rate_limit option")
+	}
 	return ovnSubnet, nil
 }
 
+// parseRouterAdvertisement Parse the router advertisement options, the M flag is cleared by default in stateless mode,
+// example: ra=true,ra_managed=true,ra_other=true,ra_autonomous=false,ra_interval=200,ra_router_lifetime=0
+func parseRouterAdvertisement(dhcpv6OptionsMap map[string]string, stateless bool) (v6.RouterAdvertisement, error) {
+	ra := v6.RouterAdvertisement{Managed: !stateless, Other: true, Interval: v6.DefaultRAInterval}
+	var err error
+	if ra.Enabled, err = parseBoolOption(dhcpv6OptionsMap, "ra", false); err != nil || !ra.Enabled {
+		return v6.RouterAdvertisement{}, err
+	}
+	if ra.Managed, err = parseBoolOption(dhcpv6OptionsMap, "ra_managed", ra.Managed); err != nil {
+		return ra, err
+	}
+	if ra.Other, err = parseBoolOption(dhcpv6OptionsMap, "ra_other", ra.Other); err != nil {
+		return ra, err
+	}
+	if ra.Autonomous, err = parseBoolOption(dhcpv6OptionsMap, "ra_autonomous", !ra.Managed); err != nil {
+		return ra, err
+	}
+	if value, ok := dhcpv6OptionsMap["ra_interval"]; ok {
+		interval, err := strconv.Atoi(value)
+		if err != nil {
+			return ra, fmt.Errorf("invalid DHCPv6 option ra_interval <%s>: %v", value, err)
+		}
+		ra.Interval = time.Duration(interval) * time.Second
+		if err = v6.ValidateRAInterval(ra.Interval); err != nil {
+			return ra, fmt.Errorf("invalid DHCPv6 option ra_interval: %v", err)
+		}
+	}
+	if value, ok := dhcpv6OptionsMap["ra_router_lifetime"]; ok {
+		lifetime, err := strconv.Atoi(value)
+		if err != nil || lifetime < 0 || lifetime > 9000 {
+			return ra, fmt.Errorf("invalid DHCPv6 option ra_router_lifetime <%s>: must be between 0 and 9000", value)
+		}
+		ra.RouterLifetime = time.Duration(lifetime) * time.Second
+	}
+	return ra, nil
+}
+
+func parseBoolOption(optionsMap map[string]string, key string, defaultValue bool) (bool, error) {
+	value, ok := optionsMap[key]
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("invalid option %s <%s>: %v", key, value, err)
+	}
+	return b, nil
+}
+
+// parseRenewalTimes Parse the renewal_time (T1) and rebinding_time (T2) options,
+// 0 means that the client chooses them, they must satisfy T1 <= T2 <= lifetime
+func parseRenewalTimes(optionsMap map[string]string, lifetime int) (int, int, error) {
+	renewalTime, err := parseSeconds(optionsMap, "renewal_time", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	rebindingTime, err := parseSeconds(optionsMap, "rebinding_time", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if renewalTime > lifetime || rebindingTime > lifetime {
+		return 0, 0, fmt.Errorf("renewal_time <%d> and rebinding_time <%d> must not exceed the lease time <%d>",
+			renewalTime, rebindingTime, lifetime)
+	}
+	if renewalTime > 0 && rebindingTime > 0 && renewalTime > rebindingTime {
+		return 0, 0, fmt.Errorf("renewal_time <%d> is greater than rebinding_time <%d>", renewalTime, rebindingTime)
+	}
+	return renewalTime, rebindingTime, nil
+}
+
+// parseRateLimit Parse the requests per second and the burst accepted from each client by the ratelimit plugin,
+// example: plugins={ratelimit;dns;hostname},rate_limit=0.5,rate_limit_burst=4
+func parseRateLimit(optionsMap map[string]string) (float64, int, error) {
+	value, ok := optionsMap["rate_limit"]
+	if !ok || value == "" {
+		return 0, 0, nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 {
+		return 0, 0, fmt.Errorf("rate_limit <%s> is not a positive number of requests per second", value)
+	}
+	burst := dhcp.DefaultRateLimitBurst
+	if value, ok = optionsMap["rate_limit_burst"]; ok && value != "" {
+		if burst, err = strconv.Atoi(value); err != nil || burst < 1 {
+			return 0, 0, fmt.Errorf("rate_limit_burst <%s> is not a positive number of requests", value)
+		}
+	}
+	return rate, burst, nil
+}
+
+// parseSeconds Parse a non-negative number of seconds
+func parseSeconds(optionsMap map[string]string, key string, defaultValue int) (int, error) {
+	value, ok := optionsMap[key]
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("%s <%s> is not a valid number of seconds", key, value)
+	}
+	return seconds, nil
+}
+
+// parseDelegatedPrefixPool Parse the pool of the prefixes delegated by IA_PD and the length of each prefix,
+// example: delegated_prefix_pool=2001:db8:100::/48,delegated_prefix_len=64 delegates up to 65536 /64 prefixes
+func parseDelegatedPrefixPool(dhcpv6OptionsMap map[string]string) (*net.IPNet, int, error) {
+	pool, ok := dhcpv6OptionsMap["delegated_prefix_pool"]
+	if !ok || pool == "" {
+		return nil, 0, nil
+	}
+	_, poolNet, err := net.ParseCIDR(pool)
+	if err != nil || poolNet.IP.To4() != nil {
+		return nil, 0, fmt.Errorf("invalid DHCPv6 option delegated_prefix_pool <%s>: not an IPv6 CIDR", pool)
+	}
+	prefixLen := 64
+	if value, ok := dhcpv6OptionsMap["delegated_prefix_len"]; ok {
+		if prefixLen, err = strconv.Atoi(value); err != nil {
+			return nil, 0, fmt.Errorf("invalid DHCPv6 option delegated_prefix_len <%s>: %v", value, err)
+		}
+	}
+	if ones, _ := poolNet.Mask.Size(); prefixLen <= ones || prefixLen > 128 {
+		return nil, 0, fmt.Errorf("invalid DHCPv6 option delegated_prefix_len <%d>: must be longer than the pool prefix /%d", prefixLen, ones)
+	}
+	return poolNet, prefixLen, nil
+}
+
+// GetDelegatedPrefix Returns the delegated prefix of the multus network from the pod annotations
+func GetDelegatedPrefix(object metav1.Object, multusName, multusNamespace string) (*net.IPNet, error) {
+	value, ok := object.GetAnnotations()[fmt.Sprintf(AnnoDCloudDelegatedPrefixTemplate, multusName, multusNamespace)]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	_, prefix, err := net.ParseCIDR(value)
+	if err != nil || prefix.IP.To4() != nil {
+		return nil, fmt.Errorf("delegated prefix <%s> is not an IPv6 CIDR", value)
+	}
+	return prefix, nil
+}
+
+// NormalizeDomainName Check that the domain name can be encoded as RFC 1035 labels,
+// the trailing root label is removed because it is appended by the encoder
+func NormalizeDomainName(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "", fmt.Errorf("domain name is empty")
+	}
+	if len(name) > 253 {
+		return "", fmt.Errorf("domain name is longer than 253 characters")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return "", fmt.Errorf("label <%s> must be 1-63 characters", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("label <%s> must not start or end with a hyphen", label)
+		}
+		for _, char := range label {
+			if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' ||
+				char >= '0' && char <= '9' || char == '-' || char == '_') {
+				return "", fmt.Errorf("label <%s> contains invalid character '%c'", label, char)
+			}
+		}
+	}
+	return name, nil
+}
+
+// parseDomainList parse the comma separated domain names of the domain search option
+func parseDomainList(value string) ([]string, error) {
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		if domain == "" {
+			continue
+		}
+		name, err := NormalizeDomainName(domain)
+		if err != nil {
+			return nil, fmt.Errorf("domain <%s>: %v", domain, err)
+		}
+		domains = append(domains, name)
+	}
+	return domains, nil
+}
+
 func IsIPv4(ipAddr string) bool {
 	ip := net.ParseIP(ipAddr)
 	return ip != nil && strings.Contains(ipAddr, ".")
@@ -174,6 +702,17 @@ func IsIPv6(ipAddr string) bool {
 	return ip != nil && strings.Contains(ipAddr, ":")
 }
 
+// GetIPV6CIDR Returns the IPv6 network of the subnet cidr block, nil if none
+func GetIPV6CIDR(cidrBlock string) *net.IPNet {
+	for _, cidr := range strings.Split(cidrBlock, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err == nil && ipNet.IP.To4() == nil {
+			return ipNet
+		}
+	}
+	return nil
+}
+
 func GetFirstIPV6Addr(status networkv1.NetworkStatus) net.IP {
 	for _, ip := range status.IPs {
 		if IsIPv6(ip) {
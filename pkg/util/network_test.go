@@ -1,11 +1,19 @@
 package util
 
 import (
+	"net"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/insomniacslk/dhcp/iana"
+	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	kubeovnv1 "github.com/kubeovn/kube-ovn/pkg/apis/kubeovn/v1"
 	"github.com/stretchr/testify/assert"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp"
+	"tydic.io/dcloud-dhcp-controller/pkg/dhcp/v4"
+	v6 "tydic.io/dcloud-dhcp-controller/pkg/dhcp/v6"
 )
 
 //IPv6 DNS
@@ -98,3 +106,385 @@ func Test_ParseDHCPOptions(t *testing.T) {
 	}
 
 }
+
+func Test_BuildOVNSubnetByIPV4Options(t *testing.T) {
+	subnet := &kubeovnv1.Subnet{
+		Spec: kubeovnv1.SubnetSpec{
+			CIDRBlock: "192.168.1.0/24",
+			Gateway:   "192.168.1.1",
+		},
+	}
+	networkStatus := networkv1.NetworkStatus{
+		Name:      "default/provider",
+		Interface: "net1",
+		IPs:       []string{"192.168.1.254"},
+		Mac:       "00:00:00:2E:2F:B8",
+	}
+	tests := []struct {
+		dhcpOptions       string
+		wantRouters       []net.IP
+		wantLeaseTime     int
+		wantAuthoritative bool
+		wantDomainName    string
+		wantDomainSearch  []string
+		wantRoutes        []string
+	}{
+		{
+			dhcpOptions:   "dns_server=223.5.5.5",
+			wantRouters:   []net.IP{net.ParseIP("192.168.1.1")},
+			wantLeaseTime: 3600,
+		},
+		{
+			dhcpOptions:       "lease_time=600,router=192.168.1.2,authoritative=true",
+			wantRouters:       []net.IP{net.ParseIP("192.168.1.2")},
+			wantLeaseTime:     600,
+			wantAuthoritative: true,
+		},
+		{
+			dhcpOptions:      "domain_name=vm.example.com.,domain_search={vm.example.com;example.com}",
+			wantRouters:      []net.IP{net.ParseIP("192.168.1.1")},
+			wantLeaseTime:    3600,
+			wantDomainName:   "vm.example.com",
+			wantDomainSearch: []string{"vm.example.com", "example.com"},
+		},
+		{
+			dhcpOptions:   "classless_static_route={10.0.0.0/8,192.168.1.2;172.16.1.0/24,192.168.1.3}",
+			wantRouters:   []net.IP{net.ParseIP("192.168.1.1")},
+			wantLeaseTime: 3600,
+			wantRoutes: []string{
+				"route to 10.0.0.0/8 via 192.168.1.2",
+				"route to 172.16.1.0/24 via 192.168.1.3",
+				"route to 0.0.0.0/0 via 192.168.1.1",
+			},
+		},
+		{
+			dhcpOptions:   "classless_static_route={10.0.0.0/8,192.168.1.2;0.0.0.0/0,192.168.1.3}",
+			wantRouters:   []net.IP{net.ParseIP("192.168.1.1")},
+			wantLeaseTime: 3600,
+			wantRoutes: []string{
+				"route to 10.0.0.0/8 via 192.168.1.2",
+				"route to 0.0.0.0/0 via 192.168.1.3",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			ovnSubnet, err := BuildOVNSubnetByIPV4Options(subnet, networkStatus, ParseDHCPOptions(test.dhcpOptions))
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantRouters, ovnSubnet.Routers)
+			assert.Equal(t, test.wantLeaseTime, ovnSubnet.LeaseTime)
+			assert.Equal(t, test.wantAuthoritative, ovnSubnet.Authoritative)
+			assert.Equal(t, test.wantDomainName, ovnSubnet.DomainName)
+			assert.Equal(t, test.wantDomainSearch, ovnSubnet.DomainSearch)
+			var routes []string
+			for _, route := range ovnSubnet.ClasslessStaticRoutes {
+				routes = append(routes, route.String())
+			}
+			assert.Equal(t, test.wantRoutes, routes)
+			assert.Equal(t, net.CIDRMask(24, 32), ovnSubnet.SubnetMask)
+			assert.Equal(t, "192.168.1.0/24", ovnSubnet.CIDR.String())
+		})
+	}
+
+	_, err := BuildOVNSubnetByIPV4Options(subnet, networkStatus, ParseDHCPOptions("authoritative=yes"))
+	assert.Error(t, err)
+	_, err = BuildOVNSubnetByIPV4Options(subnet, networkStatus, ParseDHCPOptions("plugins={ratelimit;dns}"))
+	assert.Error(t, err)
+
+	// the plugin chain is built with the subnet
+	ovnSubnet, err := BuildOVNSubnetByIPV4Options(subnet, networkStatus, ParseDHCPOptions("plugins={ratelimit;dns},rate_limit=2"))
+	assert.NoError(t, err)
+	var names []string
+	for _, plugin := range ovnSubnet.Chain {
+		names = append(names, plugin.Name)
+	}
+	assert.Equal(t, []string{"ratelimit", "dns"}, names)
+	assert.NotNil(t, ovnSubnet.RateLimiter)
+}
+
+func Test_ParseRateLimit(t *testing.T) {
+	tests := []struct {
+		dhcpOptions string
+		wantRate    float64
+		wantBurst   int
+		wantErr     bool
+	}{
+		{
+			dhcpOptions: "lease_time=600",
+		},
+		{
+			dhcpOptions: "rate_limit=0.5",
+			wantRate:    0.5,
+			wantBurst:   dhcp.DefaultRateLimitBurst,
+		},
+		{
+			dhcpOptions: "rate_limit=10,rate_limit_burst=20",
+			wantRate:    10,
+			wantBurst:   20,
+		},
+		{
+			dhcpOptions: "rate_limit=0",
+			wantErr:     true,
+		},
+		{
+			dhcpOptions: "rate_limit=10,rate_limit_burst=0",
+			wantErr:     true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			rate, burst, err := parseRateLimit(ParseDHCPOptions(test.dhcpOptions))
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantRate, rate)
+			assert.Equal(t, test.wantBurst, burst)
+		})
+	}
+}
+
+func Test_ParseClasslessStaticRoutes(t *testing.T) {
+	_, err := parseClasslessStaticRoutes("10.0.0.0/8")
+	assert.Error(t, err)
+	_, err = parseClasslessStaticRoutes("10.0.0.0/8,fe80::1")
+	assert.Error(t, err)
+	_, err = parseClasslessStaticRoutes("2001:db8::/64,10.0.0.1")
+	assert.Error(t, err)
+	routes, err := parseClasslessStaticRoutes("10.1.2.3/16,10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "route to 10.1.0.0/16 via 10.0.0.1", routes[0].String())
+}
+
+func Test_BuildOVNSubnetByIPV6Options(t *testing.T) {
+	subnet := &kubeovnv1.Subnet{
+		Spec: kubeovnv1.SubnetSpec{
+			CIDRBlock: "2001:db8::/64",
+			Gateway:   "2001:db8::1",
+		},
+	}
+	networkStatus := networkv1.NetworkStatus{
+		Name:      "default/provider",
+		Interface: "net1",
+		IPs:       []string{"2001:db8::fe"},
+		Mac:       "00:00:00:2E:2F:B8",
+	}
+	options := ParseDHCPOptions("dns_server=2400:3200::1,boot_file_url=http://[2001:db8::10]/boot.efi," +
+		"boot_file_param={console=ttyS0;quiet},ntp_server={2001:db8::123;ntp.example.com},domain_search={example.com;example.org}," +
+		"stateless=true,valid_lifetime=86400,preferred_lifetime=43200,renewal_time=300,rebinding_time=600")
+	ovnSubnet, err := BuildOVNSubnetByIPV6Options(subnet, networkStatus, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 3600, ovnSubnet.LeaseTime)
+	assert.Equal(t, "2001:db8::/64", ovnSubnet.CIDR.String())
+	assert.Equal(t, []net.IP{net.ParseIP("2400:3200::1")}, ovnSubnet.DNS)
+	assert.Equal(t, "http://[2001:db8::10]/boot.efi", ovnSubnet.BootFileURL)
+	assert.Equal(t, []string{"console=ttyS0", "quiet"}, ovnSubnet.BootFileParams)
+	assert.Equal(t, []net.IP{net.ParseIP("2001:db8::123")}, ovnSubnet.NTP)
+	assert.Equal(t, []string{"ntp.example.com"}, ovnSubnet.NTPFQDN)
+	assert.Equal(t, []string{"example.com", "example.org"}, ovnSubnet.DomainSearch)
+	assert.True(t, ovnSubnet.Stateless)
+	preferredLifetime, validLifetime := ovnSubnet.Lifetimes()
+	assert.Equal(t, 43200*time.Second, preferredLifetime)
+	assert.Equal(t, 86400*time.Second, validLifetime)
+	assert.Equal(t, 300, ovnSubnet.RenewalTime)
+	assert.Equal(t, 600, ovnSubnet.RebindingTime)
+
+	_, err = BuildOVNSubnetByIPV6Options(subnet, networkStatus, ParseDHCPOptions("valid_lifetime=600,preferred_lifetime=3600"))
+	assert.Error(t, err)
+}
+
+func Test_ParseDelegatedPrefixPool(t *testing.T) {
+	pool, prefixLen, err := parseDelegatedPrefixPool(ParseDHCPOptions("delegated_prefix_pool=2001:db8:100::/48"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:100::/48", pool.String())
+	assert.Equal(t, 64, prefixLen)
+
+	_, prefixLen, err = parseDelegatedPrefixPool(ParseDHCPOptions("delegated_prefix_pool=2001:db8:100::/48,delegated_prefix_len=56"))
+	assert.NoError(t, err)
+	assert.Equal(t, 56, prefixLen)
+
+	pool, _, err = parseDelegatedPrefixPool(ParseDHCPOptions("dns_server=2400:3200::1"))
+	assert.NoError(t, err)
+	assert.Nil(t, pool)
+
+	_, _, err = parseDelegatedPrefixPool(ParseDHCPOptions("delegated_prefix_pool=2001:db8:100::/64"))
+	assert.Error(t, err)
+
+	_, _, err = parseDelegatedPrefixPool(ParseDHCPOptions("delegated_prefix_pool=10.0.0.0/8"))
+	assert.Error(t, err)
+}
+
+func Test_ParseRouterAdvertisement(t *testing.T) {
+	ra, err := parseRouterAdvertisement(ParseDHCPOptions("dns_server=2400:3200::1"), false)
+	assert.NoError(t, err)
+	assert.False(t, ra.Enabled)
+
+	ra, err = parseRouterAdvertisement(ParseDHCPOptions("ra=true"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, v6.RouterAdvertisement{Enabled: true, Managed: true, Other: true, Interval: v6.DefaultRAInterval}, ra)
+
+	ra, err = parseRouterAdvertisement(ParseDHCPOptions("ra=true,ra_managed=false,ra_interval=30,ra_router_lifetime=1800"), false)
+	assert.NoError(t, err)
+	assert.False(t, ra.Managed)
+	assert.True(t, ra.Autonomous)
+	assert.Equal(t, 30*time.Second, ra.Interval)
+	assert.Equal(t, 1800*time.Second, ra.RouterLifetime)
+
+	ra, err = parseRouterAdvertisement(ParseDHCPOptions("ra=true"), true)
+	assert.NoError(t, err)
+	assert.False(t, ra.Managed)
+	assert.True(t, ra.Autonomous)
+
+	_, err = parseRouterAdvertisement(ParseDHCPOptions("ra=true,ra_interval=1"), false)
+	assert.Error(t, err)
+
+	_, err = parseRouterAdvertisement(ParseDHCPOptions("ra=yes"), false)
+	assert.Error(t, err)
+}
+
+func Test_ParseRenewalTimes(t *testing.T) {
+	tests := []struct {
+		options       string
+		renewalTime   int
+		rebindingTime int
+		wantErr       bool
+	}{
+		{options: "lease_time=86400"},
+		{options: "renewal_time=300,rebinding_time=600", renewalTime: 300, rebindingTime: 600},
+		{options: "renewal_time=300", renewalTime: 300},
+		{options: "renewal_time=600,rebinding_time=300", wantErr: true},
+		{options: "renewal_time=90000", wantErr: true},
+		{options: "rebinding_time=-1", wantErr: true},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			renewalTime, rebindingTime, err := parseRenewalTimes(ParseDHCPOptions(test.options), 86400)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.renewalTime, renewalTime)
+			assert.Equal(t, test.rebindingTime, rebindingTime)
+		})
+	}
+}
+
+func Test_BuildNetBoot(t *testing.T) {
+	options := ParseDHCPOptions("next_server=192.168.1.10,boot_file=pxelinux.0,boot_file_efi64=ipxe.efi," +
+		"boot_file_ipxe=http://192.168.1.10/boot.ipxe")
+	netBoot, err := buildNetBoot(options)
+	assert.NoError(t, err)
+	assert.True(t, netBoot.Enabled())
+	assert.Equal(t, net.ParseIP("192.168.1.10").To4(), netBoot.NextServer)
+	assert.Equal(t, "pxelinux.0", netBoot.BootFile)
+	assert.Equal(t, "http://192.168.1.10/boot.ipxe", netBoot.IPXEBootFile)
+	assert.Equal(t, map[iana.Arch]string{iana.EFI_X86_64: "ipxe.efi", iana.EFI_BC: "ipxe.efi"}, netBoot.ArchBootFiles)
+
+	netBoot, err = buildNetBoot(ParseDHCPOptions("http_boot_url={http://192.168.1.10/boot.efi?arch=x64}"))
+	assert.NoError(t, err)
+	assert.True(t, netBoot.Enabled())
+	assert.Equal(t, "http://192.168.1.10/boot.efi?arch=x64", netBoot.HTTPBootURL)
+
+	_, err = buildNetBoot(ParseDHCPOptions("http_boot_url=boot.efi"))
+	assert.Error(t, err)
+
+	netBoot, err = buildNetBoot(ParseDHCPOptions("dns_server=223.5.5.5"))
+	assert.NoError(t, err)
+	assert.False(t, netBoot.Enabled())
+
+	_, err = buildNetBoot(ParseDHCPOptions("next_server=tftp.example.com"))
+	assert.Error(t, err)
+}
+
+func Test_NormalizeDomainName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "example.com", want: "example.com"},
+		{name: "vm.example.com.", want: "vm.example.com"},
+		{name: "", wantErr: true},
+		{name: "a..com", wantErr: true},
+		{name: "-vm.example.com", wantErr: true},
+		{name: "vm@example.com", wantErr: true},
+		{name: strings.Repeat("a", 64) + ".com", wantErr: true},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			name, err := NormalizeDomainName(test.name)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, name)
+		})
+	}
+}
+
+func Test_GetDHCPClientClasses(t *testing.T) {
+	tests := []struct {
+		annotation  string
+		wantClasses []v4.ClientClass
+		wantErr     bool
+	}{
+		{
+			annotation: "",
+		},
+		{
+			annotation: `[{"name":"pxe","vendorClass":"PXEClient","options":{"option_60":"string:PXEClient"},"vendorOptions":{"6":"uint8:8","1":"ip:10.0.0.1"}},
+				{"name":"vnf","macPrefix":"52:54:00","userClass":"vnf"}]`,
+			wantClasses: []v4.ClientClass{
+				{
+					Name:        "pxe",
+					VendorClass: "PXEClient",
+					RawOptions:  []dhcp.RawOption{{Code: 60, Value: []byte("PXEClient")}},
+					VendorInfo:  []byte{1, 4, 10, 0, 0, 1, 6, 1, 8},
+				},
+				{
+					Name:      "vnf",
+					UserClass: "vnf",
+					MACPrefix: []byte{0x52, 0x54, 0x00},
+				},
+			},
+		},
+		{
+			annotation: `[{"name":"all"}]`,
+			wantErr:    true,
+		},
+		{
+			annotation: `[{"name":"oui","macPrefix":"52:54:zz"}]`,
+			wantErr:    true,
+		},
+		{
+			annotation: `[{"name":"pxe","vendorClass":"PXEClient","options":{"66":"string:tftp"}}]`,
+			wantErr:    true,
+		},
+		{
+			annotation: `[{"name":"pxe","vendorClass":"PXEClient","vendorOptions":{"255":"uint8:1"}}]`,
+			wantErr:    true,
+		},
+		{
+			annotation: `{"name":"pxe"}`,
+			wantErr:    true,
+		},
+	}
+	for i, test := range tests {
+		t.Run("Example_"+strconv.Itoa(i), func(t *testing.T) {
+			subnet := &kubeovnv1.Subnet{}
+			subnet.SetAnnotations(map[string]string{AnnoDCloudDHCPClientClasses: test.annotation})
+			classes, err := GetDHCPClientClasses(subnet)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantClasses, classes)
+		})
+	}
+}